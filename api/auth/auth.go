@@ -0,0 +1,79 @@
+// Package auth mints and verifies the JWTs the API uses to authenticate
+// requests, and hashes/checks the passwords behind /login and /register.
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// User is the identity carried by a validated request: who they are and
+// what they're allowed to do.
+type User struct {
+	ID   int
+	Role string
+}
+
+// ErrInvalidToken is returned by ParseToken for any token that doesn't
+// verify: wrong signature, wrong signing method, expired, or malformed.
+var ErrInvalidToken = errors.New("auth: invalid token")
+
+// claims is the JWT payload minted by NewToken.
+type claims struct {
+	UserID int    `json:"user_id"`
+	Role   string `json:"role"`
+	jwt.RegisteredClaims
+}
+
+// NewToken mints a JWT identifying userID with role, signed with secret
+// and valid for ttl.
+func NewToken(secret []byte, userID int, role string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	c := claims{
+		UserID: userID,
+		Role:   role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, c)
+	return token.SignedString(secret)
+}
+
+// ParseToken verifies tokenString against secret and returns the User it
+// identifies. It returns ErrInvalidToken for any verification failure.
+func ParseToken(secret []byte, tokenString string) (User, error) {
+	var c claims
+	token, err := jwt.ParseWithClaims(tokenString, &c, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		return secret, nil
+	})
+	if err != nil || !token.Valid {
+		return User{}, ErrInvalidToken
+	}
+
+	return User{ID: c.UserID, Role: c.Role}, nil
+}
+
+// HashPassword returns the bcrypt hash of password, for storage.
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// CheckPassword compares a bcrypt hash against a candidate password,
+// returning a non-nil error if they don't match.
+func CheckPassword(hash, password string) error {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+}
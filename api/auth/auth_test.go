@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewToken_ParseToken_RoundTrip(t *testing.T) {
+	secret := []byte("test-secret")
+
+	token, err := NewToken(secret, 7, "librarian", time.Hour)
+	assert.NoError(t, err)
+
+	user, err := ParseToken(secret, token)
+	assert.NoError(t, err)
+	assert.Equal(t, User{ID: 7, Role: "librarian"}, user)
+}
+
+func TestParseToken_RejectsWrongSecret(t *testing.T) {
+	token, err := NewToken([]byte("right-secret"), 1, "admin", time.Hour)
+	assert.NoError(t, err)
+
+	_, err = ParseToken([]byte("wrong-secret"), token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestParseToken_RejectsExpiredToken(t *testing.T) {
+	secret := []byte("test-secret")
+
+	token, err := NewToken(secret, 1, "admin", -time.Hour)
+	assert.NoError(t, err)
+
+	_, err = ParseToken(secret, token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestParseToken_RejectsMalformedToken(t *testing.T) {
+	_, err := ParseToken([]byte("test-secret"), "not-a-jwt")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestHashPassword_CheckPassword_RoundTrip(t *testing.T) {
+	hash, err := HashPassword("correct horse battery staple")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, hash)
+
+	assert.NoError(t, CheckPassword(hash, "correct horse battery staple"))
+	assert.Error(t, CheckPassword(hash, "wrong password"))
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/CristyNel/library/api/auth"
+	"github.com/CristyNel/library/api/hashid"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestRouter_AddAuthor_RequiresLibrarianRole verifies that creating an
+// author is rejected without a valid librarian token, and succeeds with
+// one.
+func TestRouter_AddAuthor_RequiresLibrarianRole(t *testing.T) {
+	app, mock := createTestApp(t)
+	defer app.DB.Close()
+
+	router := app.setupRouter()
+
+	body, err := json.Marshal(Author{Firstname: "John", Lastname: "Doe"})
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest("POST", "/authors/new", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	memberToken, err := auth.NewToken(app.JWTSecret, 1, "member", time.Hour)
+	assert.NoError(t, err)
+
+	req = httptest.NewRequest("POST", "/authors/new", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+memberToken)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	mock.ExpectExec("INSERT INTO authors").
+		WithArgs("Doe", "John", "").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	librarianToken, err := auth.NewToken(app.JWTSecret, 2, "librarian", time.Hour)
+	assert.NoError(t, err)
+
+	req = httptest.NewRequest("POST", "/authors/new", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+librarianToken)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestRouter_AddBook_RequiresLibrarianRole verifies the same role gate on
+// book creation.
+func TestRouter_AddBook_RequiresLibrarianRole(t *testing.T) {
+	app, mock := createTestApp(t)
+	defer app.DB.Close()
+
+	router := app.setupRouter()
+
+	body, err := json.Marshal(Book{Title: "Test Book", AuthorID: 1})
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest("POST", "/books/new", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	mock.ExpectExec("INSERT INTO books").
+		WithArgs("Test Book", "", "", 1, false).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	librarianToken, err := auth.NewToken(app.JWTSecret, 2, "librarian", time.Hour)
+	assert.NoError(t, err)
+
+	req = httptest.NewRequest("POST", "/books/new", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+librarianToken)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestRouter_UpdateAuthor_RequiresLibrarianRole verifies the 401/403/200
+// paths for updating an author.
+func TestRouter_UpdateAuthor_RequiresLibrarianRole(t *testing.T) {
+	app, mock := createTestApp(t)
+	defer app.DB.Close()
+
+	router := app.setupRouter()
+
+	authorToken, err := idCodec.Encode(hashid.KindAuthor, 1)
+	assert.NoError(t, err)
+
+	body, err := json.Marshal(Author{Firstname: "Jane", Lastname: "Doe"})
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest("PUT", "/authors/"+authorToken, bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	memberToken, err := auth.NewToken(app.JWTSecret, 1, "member", time.Hour)
+	assert.NoError(t, err)
+
+	req = httptest.NewRequest("PUT", "/authors/"+authorToken, bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+memberToken)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	mock.ExpectExec("UPDATE authors").
+		WithArgs("Doe", "Jane", "", 1, 1).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	librarianToken, err := auth.NewToken(app.JWTSecret, 2, "librarian", time.Hour)
+	assert.NoError(t, err)
+
+	req = httptest.NewRequest("PUT", "/authors/"+authorToken, bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+librarianToken)
+	req.Header.Set("If-Match", `"1"`)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestRouter_UpdateBook_RequiresLibrarianRole verifies the same 401/403/200
+// paths for updating a book.
+func TestRouter_UpdateBook_RequiresLibrarianRole(t *testing.T) {
+	app, mock := createTestApp(t)
+	defer app.DB.Close()
+
+	router := app.setupRouter()
+
+	bookToken, err := idCodec.Encode(hashid.KindBook, 1)
+	assert.NoError(t, err)
+
+	body, err := json.Marshal(Book{Title: "Updated Title", AuthorID: 1})
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest("PUT", "/books/"+bookToken, bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	memberToken, err := auth.NewToken(app.JWTSecret, 1, "member", time.Hour)
+	assert.NoError(t, err)
+
+	req = httptest.NewRequest("PUT", "/books/"+bookToken, bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+memberToken)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	mock.ExpectExec("UPDATE books").
+		WithArgs("Updated Title", 1, "", "", false, 1, 1).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	librarianToken, err := auth.NewToken(app.JWTSecret, 2, "librarian", time.Hour)
+	assert.NoError(t, err)
+
+	req = httptest.NewRequest("PUT", "/books/"+bookToken, bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+librarianToken)
+	req.Header.Set("If-Match", `"1"`)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestRouter_DeleteAuthor_RequiresAdminRole verifies deleting an author is
+// gated to admin, not just librarian.
+func TestRouter_DeleteAuthor_RequiresAdminRole(t *testing.T) {
+	app, mock := createTestApp(t)
+	defer app.DB.Close()
+
+	router := app.setupRouter()
+
+	authorToken, err := idCodec.Encode(hashid.KindAuthor, 1)
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest("DELETE", "/authors/"+authorToken, nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	librarianToken, err := auth.NewToken(app.JWTSecret, 2, "librarian", time.Hour)
+	assert.NoError(t, err)
+
+	req = httptest.NewRequest("DELETE", "/authors/"+authorToken, nil)
+	req.Header.Set("Authorization", "Bearer "+librarianToken)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	mock.ExpectQuery("SELECT Lastname, Firstname, photo, version FROM authors WHERE id = ?").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"Lastname", "Firstname", "photo", "version"}).
+			AddRow("Doe", "Jane", "jane.jpg", 1))
+	mock.ExpectExec("DELETE FROM authors").
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	adminToken, err := auth.NewToken(app.JWTSecret, 3, "admin", time.Hour)
+	assert.NoError(t, err)
+
+	req = httptest.NewRequest("DELETE", "/authors/"+authorToken, nil)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestRouter_DeleteBook_RequiresAdminRole verifies the same admin-only gate
+// on deleting a book.
+func TestRouter_DeleteBook_RequiresAdminRole(t *testing.T) {
+	app, mock := createTestApp(t)
+	defer app.DB.Close()
+
+	router := app.setupRouter()
+
+	bookToken, err := idCodec.Encode(hashid.KindBook, 1)
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest("DELETE", "/books/"+bookToken, nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	librarianToken, err := auth.NewToken(app.JWTSecret, 2, "librarian", time.Hour)
+	assert.NoError(t, err)
+
+	req = httptest.NewRequest("DELETE", "/books/"+bookToken, nil)
+	req.Header.Set("Authorization", "Bearer "+librarianToken)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	mock.ExpectQuery("SELECT books.title AS book_title, books.author_id AS author_id").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"book_title", "author_id", "book_photo", "is_borrowed", "book_id", "book_details", "author_lastname", "author_firstname", "book_version",
+		}).AddRow("Sample Book", 1, "book.jpg", false, 1, "details", "Doe", "Jane", 1))
+	mock.ExpectExec("DELETE FROM books").
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	adminToken, err := auth.NewToken(app.JWTSecret, 3, "admin", time.Hour)
+	assert.NoError(t, err)
+
+	req = httptest.NewRequest("DELETE", "/books/"+bookToken, nil)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestRouter_BorrowBook_RequiresLibrarianRole verifies the borrow endpoint
+// is gated the same way.
+func TestRouter_BorrowBook_RequiresLibrarianRole(t *testing.T) {
+	app, _ := createTestApp(t)
+	defer app.DB.Close()
+
+	router := app.setupRouter()
+
+	body, err := json.Marshal(map[string]int{"subscriber_id": 1, "book_id": 1})
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest("POST", "/book/borrow", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+// TestRouter_Login_Register verifies the registration/login round trip
+// through the real router.
+func TestRouter_Login_Register(t *testing.T) {
+	app, mock := createTestApp(t)
+	defer app.DB.Close()
+
+	router := app.setupRouter()
+
+	mock.ExpectExec("INSERT INTO subscribers").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	registerBody, err := json.Marshal(map[string]string{
+		"firstname": "John",
+		"lastname":  "Doe",
+		"email":     "john.doe@example.com",
+		"password":  "correct horse battery staple",
+	})
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest("POST", "/register", bytes.NewBuffer(registerBody))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	var registerResp map[string]string
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&registerResp))
+	_, err = idCodec.Decode(hashid.KindSubscriber, registerResp["id"])
+	assert.NoError(t, err)
+
+	passwordHash, err := auth.HashPassword("correct horse battery staple")
+	assert.NoError(t, err)
+
+	rows := sqlmock.NewRows([]string{"id", "password_hash", "role"}).
+		AddRow(1, passwordHash, "member")
+	mock.ExpectQuery("SELECT id, password_hash, role FROM subscribers WHERE email = ?").
+		WithArgs("john.doe@example.com").
+		WillReturnRows(rows)
+
+	loginBody, err := json.Marshal(map[string]string{
+		"email":    "john.doe@example.com",
+		"password": "correct horse battery staple",
+	})
+	assert.NoError(t, err)
+
+	req = httptest.NewRequest("POST", "/login", bytes.NewBuffer(loginBody))
+	req.Header.Set("Content-Type", "application/json")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var loginResp map[string]string
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&loginResp))
+	assert.NotEmpty(t, loginResp["token"])
+
+	user, err := auth.ParseToken(app.JWTSecret, loginResp["token"])
+	assert.NoError(t, err)
+	assert.Equal(t, auth.User{ID: 1, Role: "member"}, user)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestRouter_Login_RejectsWrongPassword verifies a bad password is
+// rejected with 401, not leaked as a 500.
+func TestRouter_Login_RejectsWrongPassword(t *testing.T) {
+	app, mock := createTestApp(t)
+	defer app.DB.Close()
+
+	router := app.setupRouter()
+
+	passwordHash, err := auth.HashPassword("correct horse battery staple")
+	assert.NoError(t, err)
+
+	rows := sqlmock.NewRows([]string{"id", "password_hash", "role"}).
+		AddRow(1, passwordHash, "member")
+	mock.ExpectQuery("SELECT id, password_hash, role FROM subscribers WHERE email = ?").
+		WithArgs("john.doe@example.com").
+		WillReturnRows(rows)
+
+	loginBody, err := json.Marshal(map[string]string{
+		"email":    "john.doe@example.com",
+		"password": "wrong password",
+	})
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest("POST", "/login", bytes.NewBuffer(loginBody))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,114 @@
+// Package backup persists point-in-time JSON snapshots of rows that are
+// about to be destructively deleted or overwritten, so they can be
+// listed and restored later.
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Record is one stored snapshot.
+type Record struct {
+	Kind      string          `json:"kind"`
+	ID        int             `json:"id"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// Backupper persists a snapshot of a row before a destructive operation,
+// and lists/retrieves those snapshots for recovery. Handlers depend on
+// this interface, not FSBackupper, so tests can inject a fake.
+type Backupper interface {
+	// Save stores data (the row, already JSON-marshaled) as a snapshot
+	// of kind/id.
+	Save(ctx context.Context, kind string, id int, data []byte) error
+	// List returns every stored snapshot, most recent first.
+	List(ctx context.Context) ([]Record, error)
+	// Load returns the most recent snapshot for kind/id.
+	Load(ctx context.Context, kind string, id int) (Record, error)
+}
+
+// ErrNotFound is returned by Load when kind/id has no snapshot.
+var ErrNotFound = fmt.Errorf("backup: no snapshot found")
+
+// FSBackupper stores snapshots as JSON files under Dir/<kind>s/<id>-<ts>.json.
+type FSBackupper struct {
+	Dir string
+}
+
+// NewFSBackupper returns a Backupper that writes snapshots under dir.
+func NewFSBackupper(dir string) *FSBackupper {
+	return &FSBackupper{Dir: dir}
+}
+
+func (b *FSBackupper) Save(ctx context.Context, kind string, id int, data []byte) error {
+	dir := filepath.Join(b.Dir, kind+"s")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	rec := Record{Kind: kind, ID: id, Data: json.RawMessage(data), CreatedAt: time.Now()}
+	encoded, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("%d-%d.json", id, rec.CreatedAt.UnixNano()))
+	return os.WriteFile(path, encoded, 0o644)
+}
+
+func (b *FSBackupper) List(ctx context.Context) ([]Record, error) {
+	var records []Record
+
+	err := filepath.WalkDir(b.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != ".json" {
+			return nil
+		}
+
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		var rec Record
+		if err := json.Unmarshal(raw, &rec); err != nil {
+			return err
+		}
+		records = append(records, rec)
+		return nil
+	})
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	sort.Slice(records, func(i, j int) bool { return records[i].CreatedAt.After(records[j].CreatedAt) })
+	return records, nil
+}
+
+func (b *FSBackupper) Load(ctx context.Context, kind string, id int) (Record, error) {
+	records, err := b.List(ctx)
+	if err != nil {
+		return Record{}, err
+	}
+
+	for _, rec := range records {
+		if rec.Kind == kind && rec.ID == id {
+			return rec, nil
+		}
+	}
+
+	return Record{}, ErrNotFound
+}
@@ -0,0 +1,33 @@
+package backup
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFSBackupper_SaveListLoad(t *testing.T) {
+	b := NewFSBackupper(t.TempDir())
+	ctx := context.Background()
+
+	assert.NoError(t, b.Save(ctx, "author", 1, []byte(`{"id":1,"lastname":"Doe"}`)))
+	assert.NoError(t, b.Save(ctx, "book", 2, []byte(`{"book_id":2,"book_title":"Foo"}`)))
+
+	records, err := b.List(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+
+	rec, err := b.Load(ctx, "author", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "author", rec.Kind)
+	assert.Equal(t, 1, rec.ID)
+	assert.JSONEq(t, `{"id":1,"lastname":"Doe"}`, string(rec.Data))
+}
+
+func TestFSBackupper_Load_NotFound(t *testing.T) {
+	b := NewFSBackupper(t.TempDir())
+
+	_, err := b.Load(context.Background(), "author", 99)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
@@ -0,0 +1,102 @@
+// Package events implements a small in-process publish/subscribe bus for
+// book borrow/return/update activity, feeding the GET /books/events
+// Server-Sent Events stream.
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Event is one book activity notification.
+type Event struct {
+	ID     int64     `json:"-"`
+	Type   string    `json:"type"` // "borrowed", "returned", or "updated"
+	BookID int       `json:"book_id"`
+	At     time.Time `json:"at"`
+}
+
+// subscriberBuffer is how many unread events a subscriber channel can
+// hold before Publish starts dropping events for it.
+const subscriberBuffer = 16
+
+// replayBufferSize is how many past events Replay can serve for
+// Last-Event-ID reconnects.
+const replayBufferSize = 100
+
+// Bus fans a stream of Events out to any number of subscribers, and
+// keeps a small ring buffer of recent events so a reconnecting client
+// can replay what it missed. The zero value is not usable; create one
+// with NewBus.
+type Bus struct {
+	mu          sync.Mutex
+	nextID      int64
+	subscribers map[chan Event]struct{}
+	ring        []Event
+}
+
+// NewBus returns an empty, ready-to-use Bus.
+func NewBus() *Bus {
+	return &Bus{subscribers: make(map[chan Event]struct{})}
+}
+
+// Publish assigns eventType/bookID/at the next sequence ID, records it in
+// the replay buffer, and delivers it to every current subscriber. A
+// subscriber whose channel is full is skipped rather than blocking the
+// publisher.
+func (b *Bus) Publish(eventType string, bookID int, at time.Time) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	ev := Event{ID: b.nextID, Type: eventType, BookID: bookID, At: at}
+
+	b.ring = append(b.ring, ev)
+	if len(b.ring) > replayBufferSize {
+		b.ring = b.ring[len(b.ring)-replayBufferSize:]
+	}
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- ev:
+		default:
+			// Slow consumer: drop the event rather than block Publish.
+		}
+	}
+
+	return ev
+}
+
+// Subscribe registers a new subscriber and returns its event channel
+// along with a function to unsubscribe and release it. Callers must call
+// the returned function when done, typically via defer.
+func (b *Bus) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+
+	unsubscribe := func() {
+		b.mu.Lock()
+		delete(b.subscribers, ch)
+		b.mu.Unlock()
+	}
+	return ch, unsubscribe
+}
+
+// Replay returns the buffered events with an ID greater than lastEventID,
+// oldest first. Events older than the ring buffer's capacity are gone
+// and not replayed.
+func (b *Bus) Replay(lastEventID int64) []Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var replayed []Event
+	for _, ev := range b.ring {
+		if ev.ID > lastEventID {
+			replayed = append(replayed, ev)
+		}
+	}
+	return replayed
+}
@@ -0,0 +1,64 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBus_PublishSubscribe(t *testing.T) {
+	b := NewBus()
+	ch, unsubscribe := b.Subscribe()
+	defer unsubscribe()
+
+	at := time.Now()
+	published := b.Publish("updated", 42, at)
+
+	select {
+	case ev := <-ch:
+		assert.Equal(t, published, ev)
+		assert.Equal(t, "updated", ev.Type)
+		assert.Equal(t, 42, ev.BookID)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for published event")
+	}
+}
+
+func TestBus_SlowConsumerDropsEvents(t *testing.T) {
+	b := NewBus()
+	ch, unsubscribe := b.Subscribe()
+	defer unsubscribe()
+
+	for i := 0; i < subscriberBuffer+5; i++ {
+		b.Publish("updated", i, time.Now())
+	}
+
+	assert.Len(t, ch, subscriberBuffer)
+}
+
+func TestBus_Replay(t *testing.T) {
+	b := NewBus()
+
+	first := b.Publish("borrowed", 1, time.Now())
+	b.Publish("returned", 1, time.Now())
+	third := b.Publish("updated", 2, time.Now())
+
+	replayed := b.Replay(first.ID)
+
+	assert.Len(t, replayed, 2)
+	assert.Equal(t, third.ID, replayed[1].ID)
+}
+
+func TestBus_ReplayCapsAtRingBufferSize(t *testing.T) {
+	b := NewBus()
+
+	for i := 0; i < replayBufferSize+10; i++ {
+		b.Publish("updated", i, time.Now())
+	}
+
+	replayed := b.Replay(0)
+
+	assert.Len(t, replayed, replayBufferSize)
+	assert.Equal(t, 10, replayed[0].BookID)
+}
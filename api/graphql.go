@@ -0,0 +1,585 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/CristyNel/library/api/hashid"
+	"github.com/CristyNel/library/api/middleware"
+	"github.com/CristyNel/library/api/store"
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/graph-gophers/graphql-go/relay"
+)
+
+// graphqlSchema is the SDL served at /graphql. It mirrors the REST
+// resource model (Book, Author, Subscriber, Loan) so both surfaces stay
+// in sync as the data model evolves.
+const graphqlSchema = `
+	schema {
+		query: Query
+		mutation: Mutation
+	}
+
+	type Query {
+		books(filter: String, page: Int): [Book!]!
+		authors(filter: String, page: Int): [Author!]!
+		subscribers: [Subscriber!]!
+		book(id: ID!): Book
+		author(id: ID!): Author
+	}
+
+	type Mutation {
+		createBook(title: String!, authorId: ID!, photo: String, details: String): Book!
+		updateBook(id: ID!, title: String!, authorId: ID!, photo: String, details: String, isBorrowed: Boolean!, version: Int!): Book!
+		deleteBook(id: ID!): Boolean!
+		createAuthor(firstname: String!, lastname: String!, photo: String): Author!
+		borrowBook(bookId: ID!, subscriberId: ID!): Loan!
+		returnBook(loanId: ID!): Boolean!
+	}
+
+	type Book {
+		id: ID!
+		title: String!
+		photo: String
+		details: String
+		isBorrowed: Boolean!
+		author: Author!
+	}
+
+	type Author {
+		id: ID!
+		firstname: String!
+		lastname: String!
+		photo: String
+	}
+
+	type Subscriber {
+		firstname: String!
+		lastname: String!
+		email: String!
+	}
+
+	type Loan {
+		id: ID!
+	}
+`
+
+// newGraphQLSchema parses graphqlSchema against a resolver backed by app,
+// so GraphQL and REST share the same store repositories, search service
+// and validation helpers.
+func newGraphQLSchema(app *App) (*graphql.Schema, error) {
+	return graphql.ParseSchema(graphqlSchema, &graphQLResolver{app: app})
+}
+
+// graphqlHandler returns the HTTP handler for /graphql, or nil (with an
+// error) if the schema fails to parse.
+func graphqlHandler(app *App) (*relay.Handler, error) {
+	schema, err := newGraphQLSchema(app)
+	if err != nil {
+		return nil, err
+	}
+	return &relay.Handler{Schema: schema}, nil
+}
+
+// graphQLResolver is the root resolver for graphqlSchema.
+type graphQLResolver struct {
+	app *App
+}
+
+func strPtr(s string) *string {
+	return &s
+}
+
+// requireRole fails resolution unless ctx carries an authenticated User
+// (stored by the middleware.OptionalAuthenticate wrapping /graphql) with
+// exactly role, mirroring the 403 REST's middleware.RequireRole returns
+// for the equivalent mutation.
+func requireRole(ctx context.Context, role string) error {
+	user, ok := middleware.UserFromContext(ctx)
+	if !ok || user.Role != role {
+		return fmt.Errorf("insufficient role: %s required", role)
+	}
+	return nil
+}
+
+// decodeGraphQLID decodes id as a hashid token of kind, the same
+// obfuscation REST's {id} path segments go through via
+// middleware.DecodeID, so a GraphQL client can't enumerate rows by
+// incrementing an ID either.
+func decodeGraphQLID(kind hashid.Kind, id graphql.ID) (int, error) {
+	if idCodec == nil {
+		return strconv.Atoi(string(id))
+	}
+	return idCodec.Decode(kind, string(id))
+}
+
+// authorLoader batches author lookups behind Book.author so that
+// resolving a list of books issues one "WHERE id IN (...)" query instead
+// of one SELECT per book.
+type authorLoader struct {
+	repo  store.AuthorRepo
+	mu    sync.Mutex
+	cache map[int]*authorResolver
+}
+
+func newAuthorLoader(repo store.AuthorRepo) *authorLoader {
+	return &authorLoader{repo: repo, cache: make(map[int]*authorResolver)}
+}
+
+// primeBooks batches a lookup of every distinct author referenced by
+// books into the loader's cache in a single query.
+func (l *authorLoader) primeBooks(ctx context.Context, books []BookAuthorInfo) error {
+	seen := make(map[int]bool, len(books))
+	ids := make([]int, 0, len(books))
+	for _, b := range books {
+		if !seen[b.AuthorID] {
+			seen[b.AuthorID] = true
+			ids = append(ids, b.AuthorID)
+		}
+	}
+	return l.prime(ctx, ids)
+}
+
+func (l *authorLoader) prime(ctx context.Context, ids []int) error {
+	l.mu.Lock()
+	var missing []int
+	for _, id := range ids {
+		if _, ok := l.cache[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+	l.mu.Unlock()
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	rows, err := l.repo.GetByIDs(ctx, missing)
+	if err != nil {
+		return err
+	}
+
+	authors, err := ScanAuthors(rows)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	for _, a := range authors {
+		l.cache[a.ID] = &authorResolver{id: int32(a.ID), firstname: a.Firstname, lastname: a.Lastname, photo: strPtr(a.Photo)}
+	}
+	l.mu.Unlock()
+
+	return nil
+}
+
+func (l *authorLoader) get(ctx context.Context, id int) (*authorResolver, error) {
+	l.mu.Lock()
+	r, ok := l.cache[id]
+	l.mu.Unlock()
+	if ok {
+		return r, nil
+	}
+
+	if err := l.prime(ctx, []int{id}); err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.cache[id], nil
+}
+
+type bookResolver struct {
+	id         int32
+	title      string
+	photo      *string
+	details    *string
+	isBorrowed bool
+	authorID   int
+	loader     *authorLoader
+}
+
+func newBookResolver(b BookAuthorInfo, loader *authorLoader) *bookResolver {
+	return &bookResolver{
+		id:         int32(b.BookID),
+		title:      b.BookTitle,
+		photo:      strPtr(b.BookPhoto),
+		details:    strPtr(b.BookDetails),
+		isBorrowed: b.IsBorrowed,
+		authorID:   b.AuthorID,
+		loader:     loader,
+	}
+}
+
+func (b *bookResolver) ID() graphql.ID   { return graphql.ID(encodeID(hashid.KindBook, int(b.id))) }
+func (b *bookResolver) Title() string    { return b.title }
+func (b *bookResolver) Photo() *string   { return b.photo }
+func (b *bookResolver) Details() *string { return b.details }
+func (b *bookResolver) IsBorrowed() bool { return b.isBorrowed }
+func (b *bookResolver) Author(ctx context.Context) (*authorResolver, error) {
+	return b.loader.get(ctx, b.authorID)
+}
+
+type authorResolver struct {
+	id        int32
+	firstname string
+	lastname  string
+	photo     *string
+}
+
+func (a *authorResolver) ID() graphql.ID    { return graphql.ID(encodeID(hashid.KindAuthor, int(a.id))) }
+func (a *authorResolver) Firstname() string { return a.firstname }
+func (a *authorResolver) Lastname() string  { return a.lastname }
+func (a *authorResolver) Photo() *string    { return a.photo }
+
+type subscriberResolver struct {
+	firstname string
+	lastname  string
+	email     string
+}
+
+func (s *subscriberResolver) Firstname() string { return s.firstname }
+func (s *subscriberResolver) Lastname() string  { return s.lastname }
+func (s *subscriberResolver) Email() string     { return s.email }
+
+type loanResolver struct {
+	id int32
+}
+
+func (l *loanResolver) ID() graphql.ID { return graphql.ID(strconv.Itoa(int(l.id))) }
+
+// Books resolves Query.books, reusing SearchService so GraphQL filtering
+// and pagination behave exactly like GET /api/v1/search/books.
+func (r *graphQLResolver) Books(ctx context.Context, args struct {
+	Filter *string
+	Page   *int32
+}) ([]*bookResolver, error) {
+	sq := SearchQuery{Page: 1, PerPage: defaultPerPage}
+	if args.Filter != nil {
+		sq.Q = *args.Filter
+	}
+	if args.Page != nil {
+		sq.Page = int(*args.Page)
+	}
+
+	result, err := NewSearchService(r.app.DB).SearchBooks(ctx, sq)
+	if err != nil {
+		return nil, err
+	}
+
+	loader := newAuthorLoader(r.app.Authors)
+	if err := loader.primeBooks(ctx, result.Items); err != nil {
+		return nil, err
+	}
+
+	resolvers := make([]*bookResolver, len(result.Items))
+	for i, b := range result.Items {
+		resolvers[i] = newBookResolver(b, loader)
+	}
+	return resolvers, nil
+}
+
+// Authors resolves Query.authors, reusing SearchService the same way
+// Books does.
+func (r *graphQLResolver) Authors(ctx context.Context, args struct {
+	Filter *string
+	Page   *int32
+}) ([]*authorResolver, error) {
+	sq := SearchQuery{Page: 1, PerPage: defaultPerPage}
+	if args.Filter != nil {
+		sq.Q = *args.Filter
+	}
+	if args.Page != nil {
+		sq.Page = int(*args.Page)
+	}
+
+	result, err := NewSearchService(r.app.DB).SearchAuthors(ctx, sq)
+	if err != nil {
+		return nil, err
+	}
+
+	resolvers := make([]*authorResolver, len(result.Items))
+	for i, a := range result.Items {
+		resolvers[i] = &authorResolver{id: int32(a.ID), firstname: a.Firstname, lastname: a.Lastname, photo: strPtr(a.Photo)}
+	}
+	return resolvers, nil
+}
+
+// Subscribers resolves Query.subscribers via SubscriberRepo, the same
+// repository GetAllSubscribers uses. It requires the same admin role
+// REST's GET /subscribers does.
+func (r *graphQLResolver) Subscribers(ctx context.Context) ([]*subscriberResolver, error) {
+	if err := requireRole(ctx, "admin"); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.app.Subscribers.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	subscribers, err := ScanSubscribers(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	resolvers := make([]*subscriberResolver, len(subscribers))
+	for i, s := range subscribers {
+		resolvers[i] = &subscriberResolver{firstname: s.Firstname, lastname: s.Lastname, email: s.Email}
+	}
+	return resolvers, nil
+}
+
+// Book resolves Query.book via BookRepo.GetByID, the same repository
+// GetBookByID uses. It returns (nil, nil) when the book doesn't exist,
+// per GraphQL convention for nullable types.
+func (r *graphQLResolver) Book(ctx context.Context, args struct{ ID graphql.ID }) (*bookResolver, error) {
+	id, err := decodeGraphQLID(hashid.KindBook, args.ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id: %s", args.ID)
+	}
+	return r.bookByID(ctx, id)
+}
+
+func (r *graphQLResolver) bookByID(ctx context.Context, id int) (*bookResolver, error) {
+	var book BookAuthorInfo
+	err := r.app.Books.GetByID(ctx, id).Scan(
+		&book.BookTitle, &book.AuthorID, &book.BookPhoto, &book.IsBorrowed,
+		&book.BookID, &book.BookDetails, &book.AuthorLastname, &book.AuthorFirstname,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return newBookResolver(book, newAuthorLoader(r.app.Authors)), nil
+}
+
+// Author resolves Query.author. It returns (nil, nil) when the author
+// doesn't exist, per GraphQL convention for nullable types.
+func (r *graphQLResolver) Author(ctx context.Context, args struct{ ID graphql.ID }) (*authorResolver, error) {
+	id, err := decodeGraphQLID(hashid.KindAuthor, args.ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id: %s", args.ID)
+	}
+
+	rows, err := r.app.Authors.GetByIDs(ctx, []int{id})
+	if err != nil {
+		return nil, err
+	}
+	authors, err := ScanAuthors(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(authors) == 0 {
+		return nil, nil
+	}
+
+	a := authors[0]
+	return &authorResolver{id: int32(a.ID), firstname: a.Firstname, lastname: a.Lastname, photo: strPtr(a.Photo)}, nil
+}
+
+// CreateBook resolves Mutation.createBook, reusing ValidateBookData and
+// BookRepo so GraphQL writes are validated exactly like POST /books/new.
+// It requires the same librarian role REST's equivalent route does.
+func (r *graphQLResolver) CreateBook(ctx context.Context, args struct {
+	Title    string
+	AuthorID graphql.ID
+	Photo    *string
+	Details  *string
+}) (*bookResolver, error) {
+	if err := requireRole(ctx, "librarian"); err != nil {
+		return nil, err
+	}
+
+	authorID, err := decodeGraphQLID(hashid.KindAuthor, args.AuthorID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid authorId: %s", args.AuthorID)
+	}
+
+	book := Book{Title: args.Title, AuthorID: authorID}
+	if args.Photo != nil {
+		book.Photo = *args.Photo
+	}
+	if args.Details != nil {
+		book.Details = *args.Details
+	}
+
+	if err := ValidateBookData(book); err != nil {
+		return nil, err
+	}
+
+	id, err := r.app.Books.Create(ctx, book.Title, book.Photo, book.Details, book.AuthorID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.bookByID(ctx, int(id))
+}
+
+// UpdateBook resolves Mutation.updateBook. version must match the book's
+// current version (mirroring the REST API's If-Match header), or the
+// mutation fails with store.ErrVersionConflict instead of silently
+// overwriting a write the caller hasn't seen. It requires the same
+// librarian role REST's equivalent route does.
+func (r *graphQLResolver) UpdateBook(ctx context.Context, args struct {
+	ID         graphql.ID
+	Title      string
+	AuthorID   graphql.ID
+	Photo      *string
+	Details    *string
+	IsBorrowed bool
+	Version    int32
+}) (*bookResolver, error) {
+	if err := requireRole(ctx, "librarian"); err != nil {
+		return nil, err
+	}
+
+	id, err := decodeGraphQLID(hashid.KindBook, args.ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id: %s", args.ID)
+	}
+	authorID, err := decodeGraphQLID(hashid.KindAuthor, args.AuthorID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid authorId: %s", args.AuthorID)
+	}
+
+	book := Book{Title: args.Title, AuthorID: authorID, IsBorrowed: args.IsBorrowed}
+	if args.Photo != nil {
+		book.Photo = *args.Photo
+	}
+	if args.Details != nil {
+		book.Details = *args.Details
+	}
+
+	if err := ValidateBookData(book); err != nil {
+		return nil, err
+	}
+
+	if _, err := r.app.Books.Update(ctx, id, book.Title, book.Photo, book.Details, book.AuthorID, book.IsBorrowed, int(args.Version)); err != nil {
+		if errors.Is(err, store.ErrVersionConflict) {
+			return nil, fmt.Errorf("version conflict: book has been updated since version %d was read", args.Version)
+		}
+		return nil, err
+	}
+
+	return r.bookByID(ctx, id)
+}
+
+// DeleteBook resolves Mutation.deleteBook. It requires the admin role
+// REST's DELETE /books/{id} does, not the librarian role the other
+// mutations accept.
+func (r *graphQLResolver) DeleteBook(ctx context.Context, args struct{ ID graphql.ID }) (bool, error) {
+	if err := requireRole(ctx, "admin"); err != nil {
+		return false, err
+	}
+
+	id, err := decodeGraphQLID(hashid.KindBook, args.ID)
+	if err != nil {
+		return false, fmt.Errorf("invalid id: %s", args.ID)
+	}
+
+	if err := r.app.Books.Delete(ctx, id); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// CreateAuthor resolves Mutation.createAuthor, reusing ValidateAuthorData
+// and AuthorRepo so GraphQL writes are validated exactly like
+// POST /authors/new. It requires the same librarian role REST's
+// equivalent route does.
+func (r *graphQLResolver) CreateAuthor(ctx context.Context, args struct {
+	Firstname string
+	Lastname  string
+	Photo     *string
+}) (*authorResolver, error) {
+	if err := requireRole(ctx, "librarian"); err != nil {
+		return nil, err
+	}
+
+	author := Author{Firstname: args.Firstname, Lastname: args.Lastname}
+	if args.Photo != nil {
+		author.Photo = *args.Photo
+	}
+
+	if err := ValidateAuthorData(author); err != nil {
+		return nil, err
+	}
+
+	id, err := r.app.Authors.Create(ctx, author.Lastname, author.Firstname, author.Photo)
+	if err != nil {
+		return nil, err
+	}
+
+	return &authorResolver{id: int32(id), firstname: author.Firstname, lastname: author.Lastname, photo: strPtr(author.Photo)}, nil
+}
+
+// BorrowBook resolves Mutation.borrowBook via LoanRepo, the same
+// transactional workflow behind POST /books/{id}/borrow. It requires the
+// same librarian role REST's equivalent route does. subscriberId stays a
+// raw integer, matching REST, which never hashid-protects subscriber
+// references in request bodies either.
+func (r *graphQLResolver) BorrowBook(ctx context.Context, args struct {
+	BookID       graphql.ID
+	SubscriberID graphql.ID
+}) (*loanResolver, error) {
+	if err := requireRole(ctx, "librarian"); err != nil {
+		return nil, err
+	}
+
+	bookID, err := decodeGraphQLID(hashid.KindBook, args.BookID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bookId: %s", args.BookID)
+	}
+	subscriberID, err := strconv.Atoi(string(args.SubscriberID))
+	if err != nil {
+		return nil, fmt.Errorf("invalid subscriberId: %s", args.SubscriberID)
+	}
+
+	loanID, err := r.app.Loans.BorrowBook(ctx, bookID, subscriberID)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.app.Events != nil {
+		r.app.Events.Publish("borrowed", bookID, time.Now())
+	}
+
+	return &loanResolver{id: int32(loanID)}, nil
+}
+
+// ReturnBook resolves Mutation.returnBook via LoanRepo, the same
+// transactional workflow behind POST /loans/{id}/return. It requires the
+// same librarian role REST's equivalent route does. loanId stays a raw
+// integer: REST never hashid-protects loan IDs either, and hashid.Kind
+// has no loan variant.
+func (r *graphQLResolver) ReturnBook(ctx context.Context, args struct{ LoanID graphql.ID }) (bool, error) {
+	if err := requireRole(ctx, "librarian"); err != nil {
+		return false, err
+	}
+
+	loanID, err := strconv.Atoi(string(args.LoanID))
+	if err != nil {
+		return false, fmt.Errorf("invalid loanId: %s", args.LoanID)
+	}
+
+	bookID, err := r.app.Loans.ReturnBook(ctx, loanID)
+	if err != nil {
+		return false, err
+	}
+
+	if r.app.Events != nil {
+		r.app.Events.Publish("returned", bookID, time.Now())
+	}
+
+	return true, nil
+}
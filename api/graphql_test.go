@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/CristyNel/library/api/auth"
+	"github.com/CristyNel/library/api/hashid"
+	"github.com/CristyNel/library/api/middleware"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func unmarshalGraphQLData(data json.RawMessage, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// librarianContext returns a context carrying an authenticated librarian
+// User, the same way middleware.Authenticate/OptionalAuthenticate would
+// populate it for a real /graphql request.
+func librarianContext() context.Context {
+	return middleware.ContextWithUser(context.Background(), auth.User{ID: 1, Role: "librarian"})
+}
+
+// adminContext returns a context carrying an authenticated admin User.
+func adminContext() context.Context {
+	return middleware.ContextWithUser(context.Background(), auth.User{ID: 1, Role: "admin"})
+}
+
+func TestGraphQL_Books_Query_BatchesAuthorLookup(t *testing.T) {
+	app, mock := createTestApp(t)
+	defer app.DB.Close()
+
+	bookRows := sqlmock.NewRows([]string{
+		"book_id", "book_title", "author_id", "book_photo", "is_borrowed", "book_details", "author_lastname", "author_firstname",
+	}).
+		AddRow(1, "The Hobbit", 1, "hobbit.jpg", false, "A hobbit's journey", "Tolkien", "J.R.R.").
+		AddRow(2, "The Silmarillion", 1, "silmarillion.jpg", false, "A history of Middle-earth", "Tolkien", "J.R.R.")
+
+	mock.ExpectQuery("FROM books JOIN authors").WillReturnRows(bookRows)
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM books JOIN authors").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+
+	// Exactly one batched author lookup, even though two books share author 1.
+	mock.ExpectQuery("SELECT id, Lastname, Firstname, photo FROM authors WHERE id IN").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "lastname", "firstname", "photo"}).AddRow(1, "Tolkien", "J.R.R.", "tolkien.jpg"))
+
+	schema, err := newGraphQLSchema(app)
+	if err != nil {
+		t.Fatalf("Error parsing schema: %v", err)
+	}
+
+	// Books is a public query, so it's exercised with no authenticated
+	// user in context at all, matching REST's unauthenticated GET /books.
+	query := `{ books { id title author { firstname lastname } } }`
+	resp := schema.Exec(context.Background(), query, "", nil)
+	if len(resp.Errors) > 0 {
+		t.Fatalf("Unexpected GraphQL errors: %v", resp.Errors)
+	}
+
+	var result struct {
+		Books []struct {
+			ID     string `json:"id"`
+			Title  string `json:"title"`
+			Author struct {
+				Firstname string `json:"firstname"`
+				Lastname  string `json:"lastname"`
+			} `json:"author"`
+		} `json:"books"`
+	}
+	if err := unmarshalGraphQLData(resp.Data, &result); err != nil {
+		t.Fatalf("Could not decode response: %v", err)
+	}
+
+	assert.Len(t, result.Books, 2)
+	wantID, err := idCodec.Encode(hashid.KindBook, 1)
+	if err != nil {
+		t.Fatalf("Error encoding expected book id: %v", err)
+	}
+	assert.Equal(t, wantID, result.Books[0].ID)
+	assert.Equal(t, "Tolkien", result.Books[0].Author.Lastname)
+	assert.Equal(t, "Tolkien", result.Books[1].Author.Lastname)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Not all expectations were met: %v", err)
+	}
+}
+
+func TestGraphQL_CreateAuthor_Mutation(t *testing.T) {
+	app, mock := createTestApp(t)
+	defer app.DB.Close()
+
+	mock.ExpectExec("INSERT INTO authors").
+		WithArgs("Doe", "Jane", "").
+		WillReturnResult(sqlmock.NewResult(5, 1))
+
+	schema, err := newGraphQLSchema(app)
+	if err != nil {
+		t.Fatalf("Error parsing schema: %v", err)
+	}
+
+	query := `mutation { createAuthor(firstname: "Jane", lastname: "Doe") { id firstname lastname } }`
+	resp := schema.Exec(librarianContext(), query, "", nil)
+	if len(resp.Errors) > 0 {
+		t.Fatalf("Unexpected GraphQL errors: %v", resp.Errors)
+	}
+
+	var result struct {
+		CreateAuthor struct {
+			ID        string `json:"id"`
+			Firstname string `json:"firstname"`
+			Lastname  string `json:"lastname"`
+		} `json:"createAuthor"`
+	}
+	if err := unmarshalGraphQLData(resp.Data, &result); err != nil {
+		t.Fatalf("Could not decode response: %v", err)
+	}
+
+	wantID, err := idCodec.Encode(hashid.KindAuthor, 5)
+	if err != nil {
+		t.Fatalf("Error encoding expected author id: %v", err)
+	}
+	assert.Equal(t, wantID, result.CreateAuthor.ID)
+	assert.Equal(t, "Jane", result.CreateAuthor.Firstname)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Not all expectations were met: %v", err)
+	}
+}
+
+func TestGraphQL_CreateAuthor_Mutation_RequiresLibrarianRole(t *testing.T) {
+	app, _ := createTestApp(t)
+	defer app.DB.Close()
+
+	schema, err := newGraphQLSchema(app)
+	if err != nil {
+		t.Fatalf("Error parsing schema: %v", err)
+	}
+
+	query := `mutation { createAuthor(firstname: "Jane", lastname: "Doe") { id } }`
+	resp := schema.Exec(context.Background(), query, "", nil)
+
+	assert.NotEmpty(t, resp.Errors, "expected an insufficient-role error with no authenticated user")
+}
+
+func TestGraphQL_CreateBook_Mutation_ValidationError(t *testing.T) {
+	app, _ := createTestApp(t)
+	defer app.DB.Close()
+
+	schema, err := newGraphQLSchema(app)
+	if err != nil {
+		t.Fatalf("Error parsing schema: %v", err)
+	}
+
+	authorID, err := idCodec.Encode(hashid.KindAuthor, 1)
+	if err != nil {
+		t.Fatalf("Error encoding author id: %v", err)
+	}
+
+	query := `mutation { createBook(title: "", authorId: "` + authorID + `") { id } }`
+	resp := schema.Exec(librarianContext(), query, "", nil)
+
+	assert.NotEmpty(t, resp.Errors, "expected a validation error for an empty title")
+}
+
+func TestGraphQL_DeleteBook_Mutation_RequiresAdminRole(t *testing.T) {
+	app, _ := createTestApp(t)
+	defer app.DB.Close()
+
+	schema, err := newGraphQLSchema(app)
+	if err != nil {
+		t.Fatalf("Error parsing schema: %v", err)
+	}
+
+	bookID, err := idCodec.Encode(hashid.KindBook, 1)
+	if err != nil {
+		t.Fatalf("Error encoding book id: %v", err)
+	}
+
+	// A librarian may create/update books, but deleteBook requires admin.
+	query := `mutation { deleteBook(id: "` + bookID + `") }`
+	resp := schema.Exec(librarianContext(), query, "", nil)
+
+	assert.NotEmpty(t, resp.Errors, "expected an insufficient-role error for a librarian calling deleteBook")
+}
+
+func TestGraphQL_BorrowBook_Mutation(t *testing.T) {
+	app, mock := createTestApp(t)
+	defer app.DB.Close()
+
+	events, unsubscribe := app.Events.Subscribe()
+	defer unsubscribe()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT is_borrowed FROM books WHERE id = \\? FOR UPDATE").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"is_borrowed"}).AddRow(false))
+	mock.ExpectExec("INSERT INTO loans").
+		WithArgs(2, 1).
+		WillReturnResult(sqlmock.NewResult(9, 1))
+	mock.ExpectExec("UPDATE books SET is_borrowed = TRUE WHERE id = \\?").
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	schema, err := newGraphQLSchema(app)
+	if err != nil {
+		t.Fatalf("Error parsing schema: %v", err)
+	}
+
+	bookID, err := idCodec.Encode(hashid.KindBook, 1)
+	if err != nil {
+		t.Fatalf("Error encoding book id: %v", err)
+	}
+
+	// subscriberId stays a raw integer: REST never hashid-protects
+	// subscriber references in request bodies either.
+	query := `mutation { borrowBook(bookId: "` + bookID + `", subscriberId: "2") { id } }`
+	resp := schema.Exec(librarianContext(), query, "", nil)
+	if len(resp.Errors) > 0 {
+		t.Fatalf("Unexpected GraphQL errors: %v", resp.Errors)
+	}
+
+	var result struct {
+		BorrowBook struct {
+			ID string `json:"id"`
+		} `json:"borrowBook"`
+	}
+	if err := unmarshalGraphQLData(resp.Data, &result); err != nil {
+		t.Fatalf("Could not decode response: %v", err)
+	}
+
+	// loanId is never hashid-protected (no hashid.KindLoan exists),
+	// matching REST's own scope for loan IDs.
+	assert.Equal(t, "9", result.BorrowBook.ID)
+
+	select {
+	case ev := <-events:
+		assert.Equal(t, "borrowed", ev.Type)
+		assert.Equal(t, 1, ev.BookID)
+	default:
+		t.Fatal("expected borrowBook to publish a book event")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Not all expectations were met: %v", err)
+	}
+}
+
+func TestGraphQL_BorrowBook_Mutation_RequiresLibrarianRole(t *testing.T) {
+	app, _ := createTestApp(t)
+	defer app.DB.Close()
+
+	schema, err := newGraphQLSchema(app)
+	if err != nil {
+		t.Fatalf("Error parsing schema: %v", err)
+	}
+
+	bookID, err := idCodec.Encode(hashid.KindBook, 1)
+	if err != nil {
+		t.Fatalf("Error encoding book id: %v", err)
+	}
+
+	// An admin may delete books, but borrowBook requires librarian.
+	query := `mutation { borrowBook(bookId: "` + bookID + `", subscriberId: "2") { id } }`
+	resp := schema.Exec(adminContext(), query, "", nil)
+
+	assert.NotEmpty(t, resp.Errors, "expected an insufficient-role error for an admin calling borrowBook")
+}
+
+func TestGraphQL_ReturnBook_Mutation(t *testing.T) {
+	app, mock := createTestApp(t)
+	defer app.DB.Close()
+
+	events, unsubscribe := app.Events.Subscribe()
+	defer unsubscribe()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT book_id FROM loans WHERE id = \\? AND returned_at IS NULL FOR UPDATE").
+		WithArgs(9).
+		WillReturnRows(sqlmock.NewRows([]string{"book_id"}).AddRow(1))
+	mock.ExpectExec("UPDATE loans SET returned_at = NOW\\(\\) WHERE id = \\?").
+		WithArgs(9).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE books SET is_borrowed = FALSE WHERE id = \\?").
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	schema, err := newGraphQLSchema(app)
+	if err != nil {
+		t.Fatalf("Error parsing schema: %v", err)
+	}
+
+	// loanId is never hashid-protected (no hashid.KindLoan exists),
+	// matching REST's own scope for loan IDs.
+	query := `mutation { returnBook(loanId: "9") }`
+	resp := schema.Exec(librarianContext(), query, "", nil)
+	if len(resp.Errors) > 0 {
+		t.Fatalf("Unexpected GraphQL errors: %v", resp.Errors)
+	}
+
+	var result struct {
+		ReturnBook bool `json:"returnBook"`
+	}
+	if err := unmarshalGraphQLData(resp.Data, &result); err != nil {
+		t.Fatalf("Could not decode response: %v", err)
+	}
+	assert.True(t, result.ReturnBook)
+
+	select {
+	case ev := <-events:
+		assert.Equal(t, "returned", ev.Type)
+		assert.Equal(t, 1, ev.BookID)
+	default:
+		t.Fatal("expected returnBook to publish a book event")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Not all expectations were met: %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+// Package hashid obfuscates the integer primary keys the API exposes in
+// URLs and creation responses, so a client can't enumerate books, authors
+// or subscribers by incrementing an ID.
+package hashid
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/speps/go-hashids/v2"
+)
+
+// Kind identifies which resource a token was minted for. Each Kind is
+// salted independently, so a token encoded for one kind fails to decode
+// under another.
+type Kind string
+
+// The kinds of resource the API mints public tokens for.
+const (
+	KindBook       Kind = "book"
+	KindAuthor     Kind = "author"
+	KindSubscriber Kind = "subscriber"
+)
+
+// ErrUnknownKind is returned when a Codec is used with a Kind it wasn't
+// configured for.
+var ErrUnknownKind = errors.New("hashid: unknown kind")
+
+// ErrInvalidToken is returned when Decode is given a token that is empty,
+// malformed, or doesn't decode to exactly one ID under the given Kind.
+var ErrInvalidToken = errors.New("hashid: invalid token")
+
+// minLength keeps tokens from being suspiciously short for small IDs.
+const minLength = 8
+
+// Codec encodes and decodes integer primary keys as opaque public tokens.
+// It derives one hashids salt per Kind from a single base salt, so tokens
+// don't collide or decode across resource types.
+type Codec struct {
+	hashers map[Kind]*hashids.HashID
+}
+
+// NewCodec builds a Codec whose per-kind salts are derived from salt.
+func NewCodec(salt string) (*Codec, error) {
+	c := &Codec{hashers: make(map[Kind]*hashids.HashID)}
+
+	for _, kind := range []Kind{KindBook, KindAuthor, KindSubscriber} {
+		data := hashids.NewData()
+		data.Salt = fmt.Sprintf("%s:%s", salt, kind)
+		data.MinLength = minLength
+
+		h, err := hashids.NewWithData(data)
+		if err != nil {
+			return nil, fmt.Errorf("hashid: building codec for kind %q: %w", kind, err)
+		}
+		c.hashers[kind] = h
+	}
+
+	return c, nil
+}
+
+// Encode returns the public token standing in for id under kind.
+func (c *Codec) Encode(kind Kind, id int) (string, error) {
+	h, ok := c.hashers[kind]
+	if !ok {
+		return "", ErrUnknownKind
+	}
+	return h.Encode([]int{id})
+}
+
+// Decode recovers the integer ID encoded in token under kind. It returns
+// ErrInvalidToken if token is empty, malformed, or was minted for a
+// different kind.
+func (c *Codec) Decode(kind Kind, token string) (int, error) {
+	h, ok := c.hashers[kind]
+	if !ok {
+		return 0, ErrUnknownKind
+	}
+	if token == "" {
+		return 0, ErrInvalidToken
+	}
+
+	ids, err := h.DecodeWithError(token)
+	if err != nil || len(ids) != 1 {
+		return 0, ErrInvalidToken
+	}
+
+	return ids[0], nil
+}
@@ -0,0 +1,58 @@
+package hashid
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCodec_RoundTrip(t *testing.T) {
+	c, err := NewCodec("test-salt")
+	assert.NoError(t, err)
+
+	token, err := c.Encode(KindBook, 42)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, token)
+
+	id, err := c.Decode(KindBook, token)
+	assert.NoError(t, err)
+	assert.Equal(t, 42, id)
+}
+
+func TestCodec_Decode_MissingToken(t *testing.T) {
+	c, err := NewCodec("test-salt")
+	assert.NoError(t, err)
+
+	_, err = c.Decode(KindBook, "")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestCodec_Decode_MalformedToken(t *testing.T) {
+	c, err := NewCodec("test-salt")
+	assert.NoError(t, err)
+
+	_, err = c.Decode(KindBook, "not-a-valid-token!!")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestCodec_Decode_WrongKindToken(t *testing.T) {
+	c, err := NewCodec("test-salt")
+	assert.NoError(t, err)
+
+	token, err := c.Encode(KindBook, 42)
+	assert.NoError(t, err)
+
+	_, err = c.Decode(KindAuthor, token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestCodec_UnknownKind(t *testing.T) {
+	c, err := NewCodec("test-salt")
+	assert.NoError(t, err)
+
+	_, err = c.Encode(Kind("loan"), 1)
+	assert.ErrorIs(t, err, ErrUnknownKind)
+
+	_, err = c.Decode(Kind("loan"), "whatever")
+	assert.ErrorIs(t, err, ErrUnknownKind)
+}
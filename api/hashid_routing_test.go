@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/CristyNel/library/api/hashid"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestRouter_DecodeID_RoundTrip verifies that a book token minted by
+// AddBook can be used as-is in a GET /books/{id} URL.
+func TestRouter_DecodeID_RoundTrip(t *testing.T) {
+	app, mock := createTestApp(t)
+	defer app.DB.Close()
+
+	router := app.setupRouter()
+
+	token, err := idCodec.Encode(hashid.KindBook, 1)
+	assert.NoError(t, err)
+
+	rows := sqlmock.NewRows([]string{
+		"book_title", "author_id", "book_photo", "is_borrowed", "book_id", "book_details", "author_lastname", "author_firstname", "book_version",
+	}).AddRow("Book Title", 1, "book.jpg", false, 1, "Book details", "Doe", "John", 1)
+
+	mock.ExpectQuery("SELECT books.title AS book_title, books.author_id AS author_id").
+		WithArgs(1).
+		WillReturnRows(rows)
+
+	req := httptest.NewRequest("GET", "/books/"+token, nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+// TestRouter_DecodeID_MissingToken verifies that an empty {id} is rejected
+// before the handler runs.
+func TestRouter_DecodeID_MissingToken(t *testing.T) {
+	app, _ := createTestApp(t)
+	defer app.DB.Close()
+
+	router := app.setupRouter()
+
+	req := httptest.NewRequest("GET", "/books/%20", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+// TestRouter_DecodeID_MalformedToken verifies that a token that doesn't
+// parse under any hashid alphabet is rejected.
+func TestRouter_DecodeID_MalformedToken(t *testing.T) {
+	app, _ := createTestApp(t)
+	defer app.DB.Close()
+
+	router := app.setupRouter()
+
+	req := httptest.NewRequest("GET", "/books/not-a-real-token", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+// TestRouter_DecodeID_WrongKindToken verifies that a token minted for a
+// different kind of resource is rejected rather than silently decoded.
+func TestRouter_DecodeID_WrongKindToken(t *testing.T) {
+	app, _ := createTestApp(t)
+	defer app.DB.Close()
+
+	router := app.setupRouter()
+
+	authorToken, err := idCodec.Encode(hashid.KindAuthor, 1)
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest("GET", "/books/"+authorToken, nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
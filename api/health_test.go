@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestHealthz_ReturnsOK verifies the liveness check never touches the
+// database.
+func TestHealthz_ReturnsOK(t *testing.T) {
+	app := &App{Logger: log.New(io.Discard, "", log.LstdFlags)}
+
+	req := httptest.NewRequest("GET", "/healthz", nil)
+	rr := httptest.NewRecorder()
+	app.Healthz(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+// TestReadyz_ReturnsOKWhenDBIsUp verifies /readyz succeeds when the
+// database ping succeeds.
+func TestReadyz_ReturnsOKWhenDBIsUp(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	assert.NoError(t, err)
+	defer db.Close()
+
+	app := &App{DB: db, Logger: log.New(io.Discard, "", log.LstdFlags)}
+
+	mock.ExpectPing()
+
+	req := httptest.NewRequest("GET", "/readyz", nil)
+	rr := httptest.NewRecorder()
+	app.Readyz(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestReadyz_ReturnsServiceUnavailableWhenDBPingFails verifies /readyz
+// flips to 503 with a JSON reason when the database ping fails.
+func TestReadyz_ReturnsServiceUnavailableWhenDBPingFails(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	assert.NoError(t, err)
+	defer db.Close()
+
+	app := &App{DB: db, Logger: log.New(io.Discard, "", log.LstdFlags)}
+
+	mock.ExpectPing().WillReturnError(fmt.Errorf("connection refused"))
+
+	req := httptest.NewRequest("GET", "/readyz", nil)
+	rr := httptest.NewRecorder()
+	app.Readyz(rr, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+
+	var body map[string]string
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&body))
+	assert.Equal(t, "unavailable", body["status"])
+	assert.NotEmpty(t, body["reason"])
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestMetrics_ExposesHTTPRequestsTotalAfterHandledRequest verifies that
+// /metrics reports the http_requests_total series for a request the
+// router just handled.
+func TestMetrics_ExposesHTTPRequestsTotalAfterHandledRequest(t *testing.T) {
+	app, _ := createTestApp(t)
+	defer app.DB.Close()
+
+	router := app.setupRouter()
+
+	req := httptest.NewRequest("GET", "/healthz", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	metricsReq := httptest.NewRequest("GET", "/metrics", nil)
+	metricsRR := httptest.NewRecorder()
+	router.ServeHTTP(metricsRR, metricsReq)
+
+	assert.Equal(t, http.StatusOK, metricsRR.Code)
+	assert.Contains(t, metricsRR.Body.String(), `http_requests_total{method="GET",route="/healthz",status="200"}`)
+}
@@ -0,0 +1,109 @@
+// Package idempotency lets write handlers safely replay the response to a
+// repeated request, keyed by the client-supplied Idempotency-Key header.
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// ErrKeyConflict means an Idempotency-Key was reused with a request body
+// that doesn't match the one it was first used with.
+var ErrKeyConflict = errors.New("idempotency: key reused with a different request body")
+
+// Store persists idempotency records in the idempotency_keys table.
+type Store struct {
+	db *sql.DB
+}
+
+// NewStore returns a Store backed by db.
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// Execute runs fn exactly once per (key, requestBody) pair within ttl.
+//
+// If key has never been seen, or its prior record has expired, Execute
+// opens a transaction, runs fn against it, persists the status and body
+// fn returns, commits, and returns that status/body with replayed=false.
+//
+// If key was already used with the same requestBody within ttl, fn is
+// not called: the stored status/body is returned verbatim with
+// replayed=true.
+//
+// If key was already used with a different requestBody within ttl,
+// Execute returns ErrKeyConflict without calling fn.
+func (s *Store) Execute(
+	ctx context.Context,
+	key string,
+	requestBody []byte,
+	ttl time.Duration,
+	fn func(tx *sql.Tx) (status int, body []byte, err error),
+) (status int, body []byte, replayed bool, err error) {
+	hash := requestHash(requestBody)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, nil, false, err
+	}
+
+	var existingHash string
+	var existingStatus int
+	var existingBody []byte
+	var createdAt time.Time
+	lookupErr := tx.QueryRowContext(
+		ctx,
+		"SELECT request_hash, response_status, response_body, created_at FROM idempotency_keys WHERE `key` = ? FOR UPDATE",
+		key,
+	).Scan(&existingHash, &existingStatus, &existingBody, &createdAt)
+
+	switch {
+	case lookupErr == nil && time.Since(createdAt) <= ttl && existingHash == hash:
+		if commitErr := tx.Commit(); commitErr != nil {
+			return 0, nil, false, commitErr
+		}
+		return existingStatus, existingBody, true, nil
+
+	case lookupErr == nil && time.Since(createdAt) <= ttl && existingHash != hash:
+		tx.Rollback()
+		return 0, nil, false, ErrKeyConflict
+
+	case lookupErr != nil && !errors.Is(lookupErr, sql.ErrNoRows):
+		tx.Rollback()
+		return 0, nil, false, lookupErr
+	}
+
+	// No record, or an expired one: run fn fresh and persist its result.
+	status, body, err = fn(tx)
+	if err != nil {
+		tx.Rollback()
+		return 0, nil, false, err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		"INSERT INTO idempotency_keys (`key`, request_hash, response_status, response_body, created_at) VALUES (?, ?, ?, ?, NOW()) "+
+			"ON DUPLICATE KEY UPDATE request_hash = VALUES(request_hash), response_status = VALUES(response_status), "+
+			"response_body = VALUES(response_body), created_at = VALUES(created_at)",
+		key, hash, status, body,
+	)
+	if err != nil {
+		tx.Rollback()
+		return 0, nil, false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, nil, false, err
+	}
+
+	return status, body, false, nil
+}
+
+func requestHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
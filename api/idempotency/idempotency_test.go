@@ -0,0 +1,156 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecute_FirstRequest_RunsFnAndPersists(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT request_hash, response_status, response_body, created_at FROM idempotency_keys WHERE `key` = \\? FOR UPDATE").
+		WithArgs("key-1").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectExec("INSERT INTO authors").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO idempotency_keys").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	store := NewStore(db)
+
+	called := false
+	status, body, replayed, err := store.Execute(
+		context.Background(), "key-1", []byte(`{"firstname":"John"}`), 24*time.Hour,
+		func(tx *sql.Tx) (int, []byte, error) {
+			called = true
+			if _, err := tx.Exec("INSERT INTO authors (lastname, firstname, photo) VALUES (?, ?, ?)", "Doe", "John", ""); err != nil {
+				return 0, nil, err
+			}
+			return 201, []byte(`{"id":"abc"}`), nil
+		},
+	)
+
+	assert.NoError(t, err)
+	assert.True(t, called)
+	assert.False(t, replayed)
+	assert.Equal(t, 201, status)
+	assert.Equal(t, []byte(`{"id":"abc"}`), body)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExecute_RepeatWithSameBody_ReplaysStoredResponse(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	requestBody := []byte(`{"firstname":"John"}`)
+	hash := requestHash(requestBody)
+
+	mock.ExpectBegin()
+	rows := sqlmock.NewRows([]string{"request_hash", "response_status", "response_body", "created_at"}).
+		AddRow(hash, 201, []byte(`{"id":"abc"}`), time.Now())
+	mock.ExpectQuery("SELECT request_hash, response_status, response_body, created_at FROM idempotency_keys WHERE `key` = \\? FOR UPDATE").
+		WithArgs("key-1").
+		WillReturnRows(rows)
+	mock.ExpectCommit()
+
+	store := NewStore(db)
+
+	called := false
+	status, body, replayed, err := store.Execute(
+		context.Background(), "key-1", requestBody, 24*time.Hour,
+		func(tx *sql.Tx) (int, []byte, error) {
+			called = true
+			return 500, nil, nil
+		},
+	)
+
+	assert.NoError(t, err)
+	assert.False(t, called, "fn should not run on a replayed request")
+	assert.True(t, replayed)
+	assert.Equal(t, 201, status)
+	assert.Equal(t, []byte(`{"id":"abc"}`), body)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExecute_RepeatWithDifferentBody_ReturnsConflict(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	storedHash := requestHash([]byte(`{"firstname":"John"}`))
+
+	mock.ExpectBegin()
+	rows := sqlmock.NewRows([]string{"request_hash", "response_status", "response_body", "created_at"}).
+		AddRow(storedHash, 201, []byte(`{"id":"abc"}`), time.Now())
+	mock.ExpectQuery("SELECT request_hash, response_status, response_body, created_at FROM idempotency_keys WHERE `key` = \\? FOR UPDATE").
+		WithArgs("key-1").
+		WillReturnRows(rows)
+	mock.ExpectRollback()
+
+	store := NewStore(db)
+
+	called := false
+	_, _, _, err = store.Execute(
+		context.Background(), "key-1", []byte(`{"firstname":"Jane"}`), 24*time.Hour,
+		func(tx *sql.Tx) (int, []byte, error) {
+			called = true
+			return 201, nil, nil
+		},
+	)
+
+	assert.ErrorIs(t, err, ErrKeyConflict)
+	assert.False(t, called)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExecute_ExpiredRecord_RunsFnAgain(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	requestBody := []byte(`{"firstname":"John"}`)
+	hash := requestHash(requestBody)
+
+	mock.ExpectBegin()
+	rows := sqlmock.NewRows([]string{"request_hash", "response_status", "response_body", "created_at"}).
+		AddRow(hash, 201, []byte(`{"id":"abc"}`), time.Now().Add(-48*time.Hour))
+	mock.ExpectQuery("SELECT request_hash, response_status, response_body, created_at FROM idempotency_keys WHERE `key` = \\? FOR UPDATE").
+		WithArgs("key-1").
+		WillReturnRows(rows)
+	mock.ExpectExec("INSERT INTO authors").
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectExec("INSERT INTO idempotency_keys").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	store := NewStore(db)
+
+	called := false
+	status, body, replayed, err := store.Execute(
+		context.Background(), "key-1", requestBody, 24*time.Hour,
+		func(tx *sql.Tx) (int, []byte, error) {
+			called = true
+			if _, err := tx.Exec("INSERT INTO authors (lastname, firstname, photo) VALUES (?, ?, ?)", "Doe", "John", ""); err != nil {
+				return 0, nil, err
+			}
+			return 201, []byte(`{"id":"def"}`), nil
+		},
+	)
+
+	assert.NoError(t, err)
+	assert.True(t, called)
+	assert.False(t, replayed)
+	assert.Equal(t, 201, status)
+	assert.Equal(t, []byte(`{"id":"def"}`), body)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
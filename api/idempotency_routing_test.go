@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// requestHashFor mirrors idempotency.requestHash, which is unexported,
+// so tests can construct rows the Store would recognize as matching.
+func requestHashFor(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// TestAddAuthor_IdempotencyKey_ReplaysOnRetry verifies that a second
+// request carrying the same Idempotency-Key and body replays the stored
+// response instead of inserting a second author.
+func TestAddAuthor_IdempotencyKey_ReplaysOnRetry(t *testing.T) {
+	app, mock := createTestApp(t)
+	defer app.DB.Close()
+
+	author := Author{Firstname: "John", Lastname: "Doe"}
+	body, err := json.Marshal(author)
+	assert.NoError(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT request_hash, response_status, response_body, created_at FROM idempotency_keys").
+		WithArgs("key-1").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectExec("INSERT INTO authors").
+		WithArgs("Doe", "John", "").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO idempotency_keys").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	req := httptest.NewRequest("POST", "/authors/new", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", "key-1")
+	rr := httptest.NewRecorder()
+	app.AddAuthor(rr, req)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	firstResponse := rr.Body.String()
+
+	mock.ExpectBegin()
+	rows := sqlmock.NewRows([]string{"request_hash", "response_status", "response_body", "created_at"}).
+		AddRow(requestHashFor(body), http.StatusCreated, []byte(firstResponse), time.Now())
+	mock.ExpectQuery("SELECT request_hash, response_status, response_body, created_at FROM idempotency_keys").
+		WithArgs("key-1").
+		WillReturnRows(rows)
+	mock.ExpectCommit()
+
+	req2 := httptest.NewRequest("POST", "/authors/new", bytes.NewBuffer(body))
+	req2.Header.Set("Content-Type", "application/json")
+	req2.Header.Set("Idempotency-Key", "key-1")
+	rr2 := httptest.NewRecorder()
+	app.AddAuthor(rr2, req2)
+	assert.Equal(t, http.StatusCreated, rr2.Code)
+	assert.JSONEq(t, firstResponse, rr2.Body.String())
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestAddAuthor_IdempotencyKey_ConflictOnDifferentBody verifies that
+// reusing a key with a different request body is rejected with 409
+// rather than silently creating a second author.
+func TestAddAuthor_IdempotencyKey_ConflictOnDifferentBody(t *testing.T) {
+	app, mock := createTestApp(t)
+	defer app.DB.Close()
+
+	firstBody, err := json.Marshal(Author{Firstname: "John", Lastname: "Doe"})
+	assert.NoError(t, err)
+	secondBody, err := json.Marshal(Author{Firstname: "Jane", Lastname: "Doe"})
+	assert.NoError(t, err)
+
+	mock.ExpectBegin()
+	rows := sqlmock.NewRows([]string{"request_hash", "response_status", "response_body", "created_at"}).
+		AddRow(requestHashFor(firstBody), http.StatusCreated, []byte(`{"id":"abc"}`), time.Now())
+	mock.ExpectQuery("SELECT request_hash, response_status, response_body, created_at FROM idempotency_keys").
+		WithArgs("key-1").
+		WillReturnRows(rows)
+	mock.ExpectRollback()
+
+	req := httptest.NewRequest("POST", "/authors/new", bytes.NewBuffer(secondBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", "key-1")
+	rr := httptest.NewRecorder()
+	app.AddAuthor(rr, req)
+
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestBorrowBook_AlreadyBorrowed_RollsBackTransaction verifies BorrowBook
+// now runs its check-and-write sequence in a transaction, so a book
+// that's already borrowed yields a rollback and a 409, not a partial
+// write.
+func TestBorrowBook_AlreadyBorrowed_RollsBackTransaction(t *testing.T) {
+	app, mock := createTestApp(t)
+	defer app.DB.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT is_borrowed FROM books WHERE id = \\? FOR UPDATE").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"is_borrowed"}).AddRow(true))
+	mock.ExpectRollback()
+
+	requestBody := struct {
+		SubscriberID int `json:"subscriber_id"`
+		BookID       int `json:"book_id"`
+	}{SubscriberID: 1, BookID: 1}
+	body, err := json.Marshal(requestBody)
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest("POST", "/book/borrow", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	app.BorrowBook(rr, req)
+
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,139 @@
+// Package imaging turns an uploaded photo into the fixed set of JPEG
+// variants (full-size, medium, thumbnail) the author/book photo endpoints
+// store on disk.
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	_ "image/png" // register the PNG decoder with image.Decode
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // register the WebP decoder with image.Decode
+)
+
+// MaxUploadSize is the default ceiling on a single photo upload, meant to
+// be enforced via http.MaxBytesReader before the body is read.
+const MaxUploadSize = 5 << 20 // 5 MiB
+
+// AllowedMIMETypes are the content types Process accepts, identified by
+// sniffing the upload's bytes rather than trusting its declared
+// Content-Type header.
+var AllowedMIMETypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/webp": true,
+}
+
+// mediumMaxEdge and thumbMaxEdge are the longest-edge pixel targets for
+// the medium and thumbnail variants; the other edge scales to preserve
+// aspect ratio.
+const (
+	mediumMaxEdge = 800
+	thumbMaxEdge  = 200
+)
+
+// Variants holds the paths of the three JPEG files Process writes for one
+// upload.
+type Variants struct {
+	Fullsize string
+	Medium   string
+	Thumb    string
+}
+
+// Process reads an image from r, rejects it unless its sniffed MIME type
+// is in AllowedMIMETypes, and writes a full-size, an 800px, and a 200px
+// variant under dir as fullsize.jpg, medium.jpg, and thumb.jpg.
+//
+// Every variant is produced by decoding the upload and re-encoding it as
+// JPEG, which is also what strips EXIF and other metadata: the
+// image/jpeg encoder never round-trips the original's metadata, so no
+// separate stripping pass is needed.
+func Process(r io.Reader, dir string) (Variants, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Variants{}, fmt.Errorf("imaging: reading upload: %w", err)
+	}
+
+	mimeType := http.DetectContentType(data)
+	if !AllowedMIMETypes[mimeType] {
+		return Variants{}, fmt.Errorf("imaging: unsupported content type %q", mimeType)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return Variants{}, fmt.Errorf("imaging: decoding image: %w", err)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return Variants{}, fmt.Errorf("imaging: creating upload directory: %w", err)
+	}
+
+	variants := Variants{
+		Fullsize: filepath.Join(dir, "fullsize.jpg"),
+		Medium:   filepath.Join(dir, "medium.jpg"),
+		Thumb:    filepath.Join(dir, "thumb.jpg"),
+	}
+
+	if err := saveJPEG(variants.Fullsize, img); err != nil {
+		return Variants{}, err
+	}
+	if err := saveJPEG(variants.Medium, scaleToFit(img, mediumMaxEdge)); err != nil {
+		return Variants{}, err
+	}
+	if err := saveJPEG(variants.Thumb, scaleToFit(img, thumbMaxEdge)); err != nil {
+		return Variants{}, err
+	}
+
+	return variants, nil
+}
+
+// scaleToFit returns img scaled down, preserving aspect ratio, so its
+// longer edge is maxEdge, using CatmullRom resampling. An image whose
+// longer edge is already within maxEdge is returned unchanged.
+func scaleToFit(img image.Image, maxEdge int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= maxEdge && height <= maxEdge {
+		return img
+	}
+
+	var newWidth, newHeight int
+	if width >= height {
+		newWidth = maxEdge
+		newHeight = height * maxEdge / width
+	} else {
+		newHeight = maxEdge
+		newWidth = width * maxEdge / height
+	}
+	if newWidth < 1 {
+		newWidth = 1
+	}
+	if newHeight < 1 {
+		newHeight = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, newWidth, newHeight))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Over, nil)
+	return dst
+}
+
+// saveJPEG encodes img as a JPEG file at path.
+func saveJPEG(path string, img image.Image) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("imaging: creating %s: %w", path, err)
+	}
+	defer out.Close()
+
+	if err := jpeg.Encode(out, img, &jpeg.Options{Quality: 90}); err != nil {
+		return fmt.Errorf("imaging: encoding %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// tinyPNG renders a solid-color width x height PNG, small enough to
+// exercise Process without needing a fixture file on disk.
+func tinyPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: 200, G: 100, B: 50, A: 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+func decodeJPEGDimensions(t *testing.T, path string) (int, int) {
+	t.Helper()
+
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	img, err := jpeg.Decode(f)
+	assert.NoError(t, err)
+
+	bounds := img.Bounds()
+	return bounds.Dx(), bounds.Dy()
+}
+
+func TestProcess_GeneratesThreeJPEGVariants(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "1")
+
+	variants, err := Process(bytes.NewReader(tinyPNG(t, 1600, 1200)), dir)
+	assert.NoError(t, err)
+
+	assert.Equal(t, filepath.Join(dir, "fullsize.jpg"), variants.Fullsize)
+	assert.Equal(t, filepath.Join(dir, "medium.jpg"), variants.Medium)
+	assert.Equal(t, filepath.Join(dir, "thumb.jpg"), variants.Thumb)
+
+	for _, path := range []string{variants.Fullsize, variants.Medium, variants.Thumb} {
+		info, err := os.Stat(path)
+		assert.NoError(t, err)
+		assert.Greater(t, info.Size(), int64(0))
+	}
+
+	width, height := decodeJPEGDimensions(t, variants.Fullsize)
+	assert.Equal(t, 1600, width)
+	assert.Equal(t, 1200, height)
+
+	width, height = decodeJPEGDimensions(t, variants.Medium)
+	assert.Equal(t, 800, width)
+	assert.Equal(t, 600, height)
+
+	width, height = decodeJPEGDimensions(t, variants.Thumb)
+	assert.Equal(t, 200, width)
+	assert.Equal(t, 150, height)
+}
+
+func TestProcess_SmallerThanTargetsIsUnscaled(t *testing.T) {
+	dir := t.TempDir()
+
+	variants, err := Process(bytes.NewReader(tinyPNG(t, 100, 80)), dir)
+	assert.NoError(t, err)
+
+	width, height := decodeJPEGDimensions(t, variants.Medium)
+	assert.Equal(t, 100, width)
+	assert.Equal(t, 80, height)
+
+	width, height = decodeJPEGDimensions(t, variants.Thumb)
+	assert.Equal(t, 100, width)
+	assert.Equal(t, 80, height)
+}
+
+func TestProcess_RejectsUnsupportedContentType(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := Process(bytes.NewReader([]byte("not an image, just text padding to exceed the sniff length 1234567890")), dir)
+	assert.Error(t, err)
+}
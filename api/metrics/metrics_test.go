@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstrument_RecordsRequestsTotal(t *testing.T) {
+	c := NewCollectors()
+
+	router := mux.NewRouter()
+	router.Use(c.Instrument)
+	router.HandleFunc("/books/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}).Methods("GET")
+
+	req := httptest.NewRequest("GET", "/books/1", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	metricsRR := httptest.NewRecorder()
+	c.Handler().ServeHTTP(metricsRR, httptest.NewRequest("GET", "/metrics", nil))
+
+	assert.Contains(t, metricsRR.Body.String(), `http_requests_total{method="GET",route="/books/{id}",status="200"}`)
+}
+
+func TestSampleDBStats_UpdatesGaugesAndObservesPing(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectPing()
+
+	c := NewCollectors()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c.SampleDBStats(ctx, db, 10*time.Millisecond)
+
+	assert.Eventually(t, func() bool {
+		return mock.ExpectationsWereMet() == nil
+	}, time.Second, 5*time.Millisecond, "expected the sampler to ping the database")
+
+	metricsRR := httptest.NewRecorder()
+	c.Handler().ServeHTTP(metricsRR, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(t, metricsRR.Body.String(), "db_ping_duration_seconds")
+	assert.Contains(t, metricsRR.Body.String(), "db_open_connections")
+}
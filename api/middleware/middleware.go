@@ -0,0 +1,309 @@
+// Package middleware provides the HTTP middleware chain shared by every
+// route registered with the API router: request ID propagation, panic
+// recovery, structured access logging, CORS, and request timeouts.
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/CristyNel/library/api/auth"
+	"github.com/CristyNel/library/api/hashid"
+	"github.com/gorilla/mux"
+)
+
+type contextKey string
+
+const requestIDKey contextKey = "requestID"
+const decodedIDsKey contextKey = "decodedIDs"
+const userKey contextKey = "user"
+
+// RequestIDHeader is the header used to read and propagate the request ID.
+const RequestIDHeader = "X-Request-ID"
+
+// RequestID assigns each request an ID (reusing one supplied by the client
+// in the X-Request-ID header, if any), stores it in the request context,
+// and echoes it back on the response.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if id == "" {
+			id = newRequestID()
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+		ctx := context.WithValue(r.Context(), requestIDKey, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// FromContext returns the request ID stored by RequestID, or "" if none.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+func newRequestID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(buf)
+}
+
+// DecodeID returns middleware that decodes the named mux var as a hashid
+// token of the given kind and stores the resulting integer ID in the
+// request context, instead of mutating the mux var in place. Handlers
+// read it back with DecodedID. A missing or malformed token, or one
+// minted for a different kind, is rejected with 404 before the handler
+// runs, so routes never have to distinguish "not found" from "bad
+// token".
+func DecodeID(codec *hashid.Codec, kind hashid.Kind, varName string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := mux.Vars(r)[varName]
+
+			id, err := codec.Decode(kind, token)
+			if err != nil {
+				http.NotFound(w, r)
+				return
+			}
+
+			ctx := withDecodedID(r.Context(), varName, id)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func withDecodedID(ctx context.Context, varName string, id int) context.Context {
+	ids, _ := ctx.Value(decodedIDsKey).(map[string]int)
+
+	next := make(map[string]int, len(ids)+1)
+	for k, v := range ids {
+		next[k] = v
+	}
+	next[varName] = id
+
+	return context.WithValue(ctx, decodedIDsKey, next)
+}
+
+// DecodedID returns the integer ID that DecodeID decoded for varName, if
+// any.
+func DecodedID(ctx context.Context, varName string) (int, bool) {
+	ids, _ := ctx.Value(decodedIDsKey).(map[string]int)
+	id, ok := ids[varName]
+	return id, ok
+}
+
+// Authenticate requires every request to carry a valid
+// "Authorization: Bearer <token>" header (the "Bearer" prefix is matched
+// case-insensitively), verifies the JWT against secret, and stores the
+// User it identifies in the request context. Missing or invalid tokens
+// are rejected with 401 before the handler runs.
+func Authenticate(secret []byte) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := bearerToken(r.Header.Get("Authorization"))
+			if !ok {
+				unauthorized(w, r, "missing bearer token")
+				return
+			}
+
+			user, err := auth.ParseToken(secret, token)
+			if err != nil {
+				unauthorized(w, r, "invalid bearer token")
+				return
+			}
+
+			ctx := ContextWithUser(r.Context(), user)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// OptionalAuthenticate parses a bearer token the same way Authenticate
+// does and stores the User it identifies in the request context, but
+// lets the request through unauthenticated when the Authorization header
+// is absent instead of rejecting it with 401. It exists for routes like
+// /graphql that mix publicly-readable queries with role-gated mutations
+// under one HTTP endpoint, so the mutations can check
+// UserFromContext/RequireRole-equivalent logic themselves. A malformed or
+// invalid token is still rejected with 401, matching Authenticate.
+func OptionalAuthenticate(secret []byte) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := bearerToken(r.Header.Get("Authorization"))
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			user, err := auth.ParseToken(secret, token)
+			if err != nil {
+				unauthorized(w, r, "invalid bearer token")
+				return
+			}
+
+			ctx := ContextWithUser(r.Context(), user)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// bearerToken extracts the token from an "Authorization: Bearer <token>"
+// header, matching "Bearer" case-insensitively.
+func bearerToken(header string) (string, bool) {
+	const prefix = "bearer "
+	if len(header) <= len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return "", false
+	}
+	return strings.TrimSpace(header[len(prefix):]), true
+}
+
+func unauthorized(w http.ResponseWriter, r *http.Request, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"code":      http.StatusUnauthorized,
+		"message":   message,
+		"requestId": FromContext(r.Context()),
+	})
+}
+
+// UserFromContext returns the User stored by Authenticate, if any.
+func UserFromContext(ctx context.Context) (auth.User, bool) {
+	user, ok := ctx.Value(userKey).(auth.User)
+	return user, ok
+}
+
+// ContextWithUser returns a copy of ctx with user stored the same way
+// Authenticate does, so code that never goes through the HTTP middleware
+// chain (resolver-level tests, OptionalAuthenticate) can still populate
+// it for UserFromContext/RequireRole-style checks.
+func ContextWithUser(ctx context.Context, user auth.User) context.Context {
+	return context.WithValue(ctx, userKey, user)
+}
+
+// RequireRole rejects requests whose authenticated User (stored by
+// Authenticate, which must run first) doesn't have exactly role, with
+// 403.
+func RequireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := UserFromContext(r.Context())
+			if !ok || user.Role != role {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusForbidden)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"code":      http.StatusForbidden,
+					"message":   "insufficient role",
+					"requestId": FromContext(r.Context()),
+				})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Recover traps panics in the handler chain, logs them with the request ID,
+// and responds with a 500 APIError-shaped JSON body instead of crashing the
+// server.
+func Recover(logger *log.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				if recovered := recover(); recovered != nil {
+					logger.Printf("panic recovered [request_id=%s]: %v", FromContext(r.Context()), recovered)
+
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusInternalServerError)
+					json.NewEncoder(w).Encode(map[string]interface{}{
+						"code":      http.StatusInternalServerError,
+						"message":   "Internal server error",
+						"requestId": FromContext(r.Context()),
+					})
+				}
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// responseRecorder captures the status code written by the inner handler so
+// AccessLog can report it.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+// Flush lets responseRecorder pass through to a streaming handler's
+// flusher, so wrapping it in AccessLog doesn't break SSE responses.
+func (rec *responseRecorder) Flush() {
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// AccessLog writes one structured JSON line per request to logger, including
+// the method, path, status code, duration, and request ID.
+func AccessLog(logger *log.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+
+			next.ServeHTTP(rec, r)
+
+			entry, err := json.Marshal(map[string]interface{}{
+				"requestId":  FromContext(r.Context()),
+				"method":     r.Method,
+				"path":       r.URL.Path,
+				"status":     rec.status,
+				"durationMs": time.Since(start).Milliseconds(),
+			})
+			if err != nil {
+				logger.Printf("error encoding access log entry: %v", err)
+				return
+			}
+			logger.Println(string(entry))
+		})
+	}
+}
+
+// CORS allows cross-origin requests from any origin and short-circuits
+// preflight OPTIONS requests.
+func CORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Authorization, Idempotency-Key, If-Match")
+
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Timeout aborts the handler chain and responds with 504 if it runs longer
+// than d.
+func Timeout(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.TimeoutHandler(next, d, `{"code":504,"message":"request timed out"}`)
+	}
+}
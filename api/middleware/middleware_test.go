@@ -0,0 +1,267 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/CristyNel/library/api/auth"
+	"github.com/CristyNel/library/api/hashid"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestID_GeneratesAndPropagates(t *testing.T) {
+	var seen string
+	handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = FromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.NotEmpty(t, seen, "expected a request ID to be generated")
+	assert.Equal(t, seen, rr.Header().Get(RequestIDHeader), "response header should echo the request ID")
+}
+
+func TestRequestID_ReusesClientSuppliedID(t *testing.T) {
+	var seen string
+	handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = FromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(RequestIDHeader, "client-supplied-id")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, "client-supplied-id", seen)
+	assert.Equal(t, "client-supplied-id", rr.Header().Get(RequestIDHeader))
+}
+
+func TestRecover_TrapsPanicAndReturns500JSON(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.New(&buf, "", 0)
+
+	handler := RequestID(Recover(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	rr := httptest.NewRecorder()
+
+	assert.NotPanics(t, func() { handler.ServeHTTP(rr, req) })
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+
+	var body map[string]interface{}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+	assert.Equal(t, float64(http.StatusInternalServerError), body["code"])
+	assert.Contains(t, buf.String(), "panic recovered")
+}
+
+func TestAccessLog_WritesStructuredEntryWithRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.New(&buf, "", 0)
+
+	handler := RequestID(AccessLog(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})))
+
+	req := httptest.NewRequest("GET", "/teapot", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	var entry map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "GET", entry["method"])
+	assert.Equal(t, "/teapot", entry["path"])
+	assert.Equal(t, float64(http.StatusTeapot), entry["status"])
+	assert.Equal(t, rr.Header().Get(RequestIDHeader), entry["requestId"])
+}
+
+func TestCORS_SetsHeadersAndShortCircuitsPreflight(t *testing.T) {
+	called := false
+	handler := CORS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+
+	req := httptest.NewRequest("OPTIONS", "/", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Equal(t, "*", rr.Header().Get("Access-Control-Allow-Origin"))
+	assert.False(t, called, "preflight requests should not reach the next handler")
+}
+
+func TestDecodeID_RoundTrip(t *testing.T) {
+	codec, err := hashid.NewCodec("test-salt")
+	assert.NoError(t, err)
+
+	token, err := codec.Encode(hashid.KindBook, 42)
+	assert.NoError(t, err)
+
+	var seen int
+	var ok bool
+	handler := DecodeID(codec, hashid.KindBook, "id")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, ok = DecodedID(r.Context(), "id")
+	}))
+
+	req := httptest.NewRequest("GET", "/books/"+token, nil)
+	req = mux.SetURLVars(req, map[string]string{"id": token})
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.True(t, ok, "expected a decoded ID to be stored in the context")
+	assert.Equal(t, 42, seen)
+}
+
+func TestDecodeID_MissingToken(t *testing.T) {
+	codec, err := hashid.NewCodec("test-salt")
+	assert.NoError(t, err)
+
+	called := false
+	handler := DecodeID(codec, hashid.KindBook, "id")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+
+	req := httptest.NewRequest("GET", "/books/", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": ""})
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.False(t, called, "handler should not run without a valid token")
+}
+
+func TestDecodeID_MalformedToken(t *testing.T) {
+	codec, err := hashid.NewCodec("test-salt")
+	assert.NoError(t, err)
+
+	handler := DecodeID(codec, hashid.KindBook, "id")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("handler should not run for a malformed token")
+	}))
+
+	req := httptest.NewRequest("GET", "/books/not-a-token", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "not-a-token"})
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestDecodeID_WrongKindToken(t *testing.T) {
+	codec, err := hashid.NewCodec("test-salt")
+	assert.NoError(t, err)
+
+	token, err := codec.Encode(hashid.KindAuthor, 1)
+	assert.NoError(t, err)
+
+	handler := DecodeID(codec, hashid.KindBook, "id")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("handler should not run for a token minted for a different kind")
+	}))
+
+	req := httptest.NewRequest("GET", "/books/"+token, nil)
+	req = mux.SetURLVars(req, map[string]string{"id": token})
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestAuthenticate_RejectsMissingHeader(t *testing.T) {
+	called := false
+	handler := Authenticate([]byte("secret"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.False(t, called)
+}
+
+func TestAuthenticate_RejectsInvalidToken(t *testing.T) {
+	handler := Authenticate([]byte("secret"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("handler should not run for an invalid token")
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer not-a-real-token")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+func TestAuthenticate_AcceptsCaseInsensitiveBearerPrefixAndInjectsUser(t *testing.T) {
+	secret := []byte("secret")
+	token, err := auth.NewToken(secret, 3, "librarian", time.Hour)
+	assert.NoError(t, err)
+
+	var seen auth.User
+	var ok bool
+	handler := Authenticate(secret)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, ok = UserFromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "BEARER "+token)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.True(t, ok)
+	assert.Equal(t, auth.User{ID: 3, Role: "librarian"}, seen)
+}
+
+func TestRequireRole_RejectsWrongRole(t *testing.T) {
+	called := false
+	handler := RequireRole("admin")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	ctx := context.WithValue(req.Context(), userKey, auth.User{ID: 1, Role: "librarian"})
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req.WithContext(ctx))
+
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.False(t, called)
+}
+
+func TestRequireRole_AllowsMatchingRole(t *testing.T) {
+	called := false
+	handler := RequireRole("admin")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	ctx := context.WithValue(req.Context(), userKey, auth.User{ID: 1, Role: "admin"})
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req.WithContext(ctx))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.True(t, called)
+}
+
+func TestTimeout_AbortsSlowHandlers(t *testing.T) {
+	handler := Timeout(0)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/CristyNel/library/api/hashid"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestGetAuthors_AcceptCSVStreamsRows verifies that GetAuthors honors
+// Accept: text/csv by streaming the author rows as CSV instead of the
+// usual {data, page, ...} JSON envelope.
+func TestGetAuthors_AcceptCSVStreamsRows(t *testing.T) {
+	app, mock := createTestApp(t)
+	defer app.DB.Close()
+
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM authors`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery(`SELECT id, Lastname, Firstname, photo FROM authors ORDER BY Lastname, Firstname LIMIT \? OFFSET \?`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "Lastname", "Firstname", "photo"}).AddRow(1, "Doe", "Jane", "jane.jpg"))
+
+	req := httptest.NewRequest("GET", "/authors", nil)
+	req.Header.Set("Accept", "text/csv")
+	rr := httptest.NewRecorder()
+	app.GetAuthors(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "text/csv", rr.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="authors.csv"`, rr.Header().Get("Content-Disposition"))
+
+	rows, err := csv.NewReader(rr.Body).ReadAll()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"id", "firstname", "lastname", "photo", "version"}, rows[0])
+	authorID, err := idCodec.Encode(hashid.KindAuthor, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{authorID, "Jane", "Doe", "jane.jpg", "0"}, rows[1])
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestGetAllSubscribers_AcceptXMLReturnsXMLBody verifies that
+// GetAllSubscribers honors Accept: application/xml.
+func TestGetAllSubscribers_AcceptXMLReturnsXMLBody(t *testing.T) {
+	app, mock := createTestApp(t)
+	defer app.DB.Close()
+
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM subscribers`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery(`SELECT lastname, firstname, email FROM subscribers ORDER BY lastname, firstname LIMIT \? OFFSET \?`).
+		WillReturnRows(sqlmock.NewRows([]string{"lastname", "firstname", "email"}).AddRow("Doe", "Jane", "jane@example.com"))
+
+	req := httptest.NewRequest("GET", "/subscribers", nil)
+	req.Header.Set("Accept", "application/xml")
+	rr := httptest.NewRecorder()
+	app.GetAllSubscribers(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/xml", rr.Header().Get("Content-Type"))
+
+	var resp ListResponse
+	assert.NoError(t, xml.Unmarshal(rr.Body.Bytes(), &resp))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestGetAllBooks_AcceptCSVStreamsRows verifies that GetAllBooks streams a
+// CSV attachment rather than a JSON envelope when the client asks for one.
+func TestGetAllBooks_AcceptCSVStreamsRows(t *testing.T) {
+	app, mock := createTestApp(t)
+	defer app.DB.Close()
+
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM books JOIN authors ON books.author_id = authors.id`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery(`SELECT (.+) FROM books JOIN authors ON books.author_id = authors.id ORDER BY books.id LIMIT \? OFFSET \?`).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"book_id", "book_title", "author_id", "book_photo", "is_borrowed", "book_details", "author_lastname", "author_firstname",
+		}).AddRow(1, "Sample Book", 1, "book.jpg", false, "details", "Doe", "Jane"))
+
+	req := httptest.NewRequest("GET", "/books", nil)
+	req.Header.Set("Accept", "text/csv")
+	rr := httptest.NewRecorder()
+	app.GetAllBooks(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "text/csv", rr.Header().Get("Content-Type"))
+	assert.Contains(t, rr.Header().Get("Content-Disposition"), ".csv")
+
+	rows, err := csv.NewReader(rr.Body).ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, rows, 2)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
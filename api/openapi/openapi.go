@@ -0,0 +1,214 @@
+// Package openapi builds an OpenAPI 3.0 document describing an HTTP
+// API's routes, with request/response schemas derived by reflecting over
+// the json tags of the structs those routes exchange.
+package openapi
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// Document is the root of an OpenAPI 3.0 document.
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+// Info is the OpenAPI document's title/version block.
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// PathItem maps a lowercase HTTP method ("get", "post", ...) to the
+// operation served at that path for that method.
+type PathItem map[string]Operation
+
+// Operation describes one (method, path) pair.
+type Operation struct {
+	Summary     string              `json:"summary,omitempty"`
+	Parameters  []Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]Response `json:"responses"`
+}
+
+// Parameter describes a path, query or header parameter.
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema,omitempty"`
+}
+
+// RequestBody describes an operation's request payload.
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Response describes one status code an operation may return.
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// MediaType pairs a request/response body with its schema.
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+// Components holds the document's reusable, named schemas.
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas,omitempty"`
+}
+
+// Schema is a deliberately partial OpenAPI 3.0 Schema Object: enough to
+// describe the flat request/response structs this kind of API exchanges.
+type Schema struct {
+	Type       string             `json:"type,omitempty"`
+	Items      *Schema            `json:"items,omitempty"`
+	Properties map[string]*Schema `json:"properties,omitempty"`
+	Ref        string             `json:"$ref,omitempty"`
+}
+
+// NewDocument returns an empty OpenAPI 3.0 document titled title, at
+// version version.
+func NewDocument(title, version string) *Document {
+	return &Document{
+		OpenAPI:    "3.0.3",
+		Info:       Info{Title: title, Version: version},
+		Paths:      map[string]PathItem{},
+		Components: Components{Schemas: map[string]*Schema{}},
+	}
+}
+
+// AddSchema reflects over v's type to build a schema named name, and
+// registers it under components/schemas so SchemaRef(name) can point to
+// it from a request or response body.
+func (d *Document) AddSchema(name string, v interface{}) {
+	d.Components.Schemas[name] = SchemaFor(v)
+}
+
+// SchemaRef returns a "$ref" schema pointing at the named component
+// schema previously registered with AddSchema.
+func SchemaRef(name string) *Schema {
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// ListSchema wraps item as the "data" array of a paginated list response
+// envelope: {data, page, page_size, total, next}.
+func ListSchema(item *Schema) *Schema {
+	return &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"data":      {Type: "array", Items: item},
+			"page":      {Type: "integer"},
+			"page_size": {Type: "integer"},
+			"total":     {Type: "integer"},
+			"next":      {Type: "string"},
+		},
+	}
+}
+
+// SchemaFor builds a Schema describing v's type by reflecting over its
+// exported fields' json tags. Structs become "object" schemas, slices
+// become "array" schemas of their element type, and everything else maps
+// to the closest OpenAPI primitive type.
+func SchemaFor(v interface{}) *Schema {
+	return schemaForType(reflect.TypeOf(v))
+}
+
+func schemaForType(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		properties := map[string]*Schema{}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" {
+				continue // unexported
+			}
+
+			tag := field.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+
+			name := strings.Split(tag, ",")[0]
+			if name == "" {
+				name = field.Name
+			}
+
+			properties[name] = schemaForType(field.Type)
+		}
+		return &Schema{Type: "object", Properties: properties}
+
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: schemaForType(t.Elem())}
+
+	case reflect.String:
+		return &Schema{Type: "string"}
+
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+
+	default:
+		return &Schema{Type: "object"}
+	}
+}
+
+// pathParamPattern matches a mux-style path variable such as "{id}" or
+// "{id:[0-9]+}".
+var pathParamPattern = regexp.MustCompile(`\{([a-zA-Z0-9_]+)(:[^}]*)?\}`)
+
+// AddRoute registers an operation for method (e.g. "GET") and path (a
+// mux-style path template such as "/books/{id}"). Path parameters named
+// in path are added to op.Parameters automatically, unless op already
+// declares one with the same name.
+func (d *Document) AddRoute(method, path string, op Operation) {
+	for _, name := range pathParamNames(path) {
+		if !hasPathParameter(op.Parameters, name) {
+			op.Parameters = append(op.Parameters, Parameter{
+				Name: name, In: "path", Required: true, Schema: &Schema{Type: "string"},
+			})
+		}
+	}
+
+	item, ok := d.Paths[path]
+	if !ok {
+		item = PathItem{}
+	}
+	item[strings.ToLower(method)] = op
+	d.Paths[path] = item
+}
+
+func hasPathParameter(params []Parameter, name string) bool {
+	for _, p := range params {
+		if p.In == "path" && p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func pathParamNames(path string) []string {
+	matches := pathParamPattern.FindAllStringSubmatch(path, -1)
+	names := make([]string, 0, len(matches))
+	for _, m := range matches {
+		names = append(names, m[1])
+	}
+	return names
+}
@@ -0,0 +1,82 @@
+package openapi
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/stretchr/testify/assert"
+)
+
+type sampleAuthor struct {
+	ID        int    `json:"id"`
+	Firstname string `json:"firstname"`
+	Lastname  string `json:"lastname"`
+	Photo     string `json:"photo,omitempty"`
+	internal  string
+}
+
+func TestSchemaFor_StructUsesJSONTags(t *testing.T) {
+	schema := SchemaFor(sampleAuthor{})
+
+	assert.Equal(t, "object", schema.Type)
+	assert.Contains(t, schema.Properties, "id")
+	assert.Equal(t, "integer", schema.Properties["id"].Type)
+	assert.Contains(t, schema.Properties, "firstname")
+	assert.Equal(t, "string", schema.Properties["firstname"].Type)
+	assert.NotContains(t, schema.Properties, "internal")
+}
+
+func TestSchemaFor_Slice(t *testing.T) {
+	schema := SchemaFor([]sampleAuthor{})
+
+	assert.Equal(t, "array", schema.Type)
+	assert.Equal(t, "object", schema.Items.Type)
+}
+
+func TestAddRoute_InfersPathParameters(t *testing.T) {
+	doc := NewDocument("Test API", "1.0.0")
+	doc.AddRoute("GET", "/authors/{id}", Operation{
+		Summary:   "Get an author",
+		Responses: map[string]Response{"200": {Description: "OK"}},
+	})
+
+	op := doc.Paths["/authors/{id}"]["get"]
+	assert.Len(t, op.Parameters, 1)
+	assert.Equal(t, "id", op.Parameters[0].Name)
+	assert.Equal(t, "path", op.Parameters[0].In)
+	assert.True(t, op.Parameters[0].Required)
+}
+
+// TestDocument_ValidatesAsOpenAPI3 builds a small but representative
+// document (a schema, a list response, a path-parameterized route) and
+// confirms kin-openapi accepts it as a well-formed OpenAPI 3.0 document.
+func TestDocument_ValidatesAsOpenAPI3(t *testing.T) {
+	doc := NewDocument("Test API", "1.0.0")
+	doc.AddSchema("Author", sampleAuthor{})
+
+	doc.AddRoute("GET", "/authors", Operation{
+		Summary: "List authors",
+		Responses: map[string]Response{
+			"200": {
+				Description: "OK",
+				Content:     map[string]MediaType{"application/json": {Schema: ListSchema(SchemaRef("Author"))}},
+			},
+		},
+	})
+	doc.AddRoute("GET", "/authors/{id}", Operation{
+		Summary: "Get an author's books",
+		Responses: map[string]Response{
+			"200": {Description: "OK"},
+			"404": {Description: "Not found"},
+		},
+	})
+
+	raw, err := json.Marshal(doc)
+	assert.NoError(t, err)
+
+	loaded, err := openapi3.NewLoader().LoadFromData(raw)
+	assert.NoError(t, err)
+	assert.NoError(t, loaded.Validate(context.Background()))
+}
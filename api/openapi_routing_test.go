@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+var routingTestPathParamPattern = regexp.MustCompile(`\{([a-zA-Z0-9_]+)(:[^}]*)?\}`)
+
+// TestOpenAPIJSON_ValidatesAndCoversRegisteredRoutes fetches /openapi.json
+// through the router, confirms kin-openapi accepts it as well-formed
+// OpenAPI 3.0, and asserts every route in routeDocs (and therefore every
+// route registered on the mux with a routeDocs entry) shows up as an
+// operation with its path parameters and documented status codes intact.
+func TestOpenAPIJSON_ValidatesAndCoversRegisteredRoutes(t *testing.T) {
+	app, mock := createTestApp(t)
+	defer app.DB.Close()
+
+	router := app.setupRouter()
+
+	req := httptest.NewRequest("GET", "/openapi.json", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	loaded, err := openapi3.NewLoader().LoadFromData(rr.Body.Bytes())
+	assert.NoError(t, err)
+	assert.NoError(t, loaded.Validate(context.Background()))
+
+	var spec struct {
+		Paths map[string]map[string]struct {
+			Parameters []struct {
+				Name string `json:"name"`
+				In   string `json:"in"`
+			} `json:"parameters"`
+			Responses map[string]struct{} `json:"responses"`
+		} `json:"paths"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &spec))
+
+	registered := map[routeKey]bool{}
+	err = router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		for _, method := range methods {
+			registered[routeKey{method, path}] = true
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+
+	for key, op := range routeDocs {
+		assert.True(t, registered[key], "routeDocs entry %s %s is not registered on the mux", key.Method, key.Path)
+
+		operations, ok := spec.Paths[key.Path]
+		if !assert.True(t, ok, "spec is missing path %s", key.Path) {
+			continue
+		}
+		operation, ok := operations[strings.ToLower(key.Method)]
+		if !assert.True(t, ok, "spec is missing operation %s %s", key.Method, key.Path) {
+			continue
+		}
+
+		for status := range op.Responses {
+			assert.Contains(t, operation.Responses, status, "spec is missing status %s for %s %s", status, key.Method, key.Path)
+		}
+
+		for _, match := range routingTestPathParamPattern.FindAllStringSubmatch(key.Path, -1) {
+			name := match[1]
+			found := false
+			for _, p := range operation.Parameters {
+				if p.Name == name && p.In == "path" {
+					found = true
+				}
+			}
+			assert.True(t, found, "spec is missing path parameter %s for %s %s", name, key.Method, key.Path)
+		}
+	}
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,260 @@
+// openapi_spec.go builds the API's OpenAPI 3.0 document from its
+// registered routes and serves it alongside a Swagger UI page.
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/CristyNel/library/api/backup"
+	"github.com/CristyNel/library/api/openapi"
+	"github.com/gorilla/mux"
+)
+
+// routeKey identifies one (method, path template) pair in routeDocs.
+type routeKey struct {
+	Method string
+	Path   string
+}
+
+// jsonBody wraps schema as an operation's sole "application/json"
+// request or response body.
+func jsonBody(schema *openapi.Schema) map[string]openapi.MediaType {
+	return map[string]openapi.MediaType{"application/json": {Schema: schema}}
+}
+
+// okResponse is the shared, bodyless "200 OK" response used by routes
+// that don't return JSON.
+var okResponse = openapi.Response{Description: "OK"}
+
+// routeDocs describes every handler covered by main_test.go, keyed by the
+// method and mux path template setupRouter registers it under. Routes
+// without an entry here (graphql, metrics, health checks) are omitted
+// from the generated spec rather than guessed at.
+var routeDocs = map[routeKey]openapi.Operation{
+	{"GET", "/authors"}: {
+		Summary:   "List authors",
+		Responses: map[string]openapi.Response{"200": {Description: "OK", Content: jsonBody(openapi.ListSchema(openapi.SchemaRef("AuthorView")))}},
+	},
+	{"GET", "/authors/search"}: {
+		Summary:   "Search authors by name",
+		Responses: map[string]openapi.Response{"200": {Description: "OK", Content: jsonBody(&openapi.Schema{Type: "array", Items: openapi.SchemaRef("AuthorView")})}, "400": {Description: "Missing query parameter"}},
+	},
+	{"POST", "/authors/new"}: {
+		Summary:     "Create an author",
+		RequestBody: &openapi.RequestBody{Required: true, Content: jsonBody(openapi.SchemaRef("Author"))},
+		Responses:   map[string]openapi.Response{"201": {Description: "Created"}, "400": {Description: "Invalid request body"}, "409": {Description: "Idempotency key reused with a different request body"}, "500": {Description: "Internal error"}},
+	},
+	{"GET", "/authors/{id}"}: {
+		Summary:   "Get an author with their books",
+		Responses: map[string]openapi.Response{"200": okResponse, "400": {Description: "Invalid author ID"}, "500": {Description: "Internal error"}},
+	},
+	{"PUT", "/authors/{id}"}: {
+		Summary:     "Update an author",
+		RequestBody: &openapi.RequestBody{Required: true, Content: jsonBody(openapi.SchemaRef("Author"))},
+		Responses:   map[string]openapi.Response{"200": okResponse, "400": {Description: "Invalid request, or missing/malformed If-Match header"}, "409": {Description: "Version conflict: If-Match didn't match the author's current version; response body is the current author"}, "500": {Description: "Internal error"}},
+	},
+	{"PATCH", "/authors/{id}"}: {
+		Summary:     "Partially update an author",
+		RequestBody: &openapi.RequestBody{Required: true, Content: jsonBody(&openapi.Schema{Type: "object"})},
+		Responses:   map[string]openapi.Response{"200": okResponse, "400": {Description: "Invalid request, empty/unrecognized body, or missing/malformed If-Match header"}, "409": {Description: "Version conflict: If-Match didn't match the author's current version; response body is the current author"}, "500": {Description: "Internal error"}},
+	},
+	{"DELETE", "/authors/{id}"}: {
+		Summary:   "Delete an author",
+		Responses: map[string]openapi.Response{"200": okResponse, "400": {Description: "Invalid author ID"}, "500": {Description: "Internal error"}},
+	},
+	{"PUT", "/authors"}: {
+		Summary:     "Bulk-update authors transactionally",
+		RequestBody: &openapi.RequestBody{Required: true, Content: jsonBody(&openapi.Schema{Type: "array", Items: openapi.SchemaRef("Author")})},
+		Responses:   map[string]openapi.Response{"200": {Description: "All updates applied", Content: jsonBody(&openapi.Schema{Type: "array", Items: openapi.SchemaRef("BulkUpdateResult")})}, "400": {Description: "Invalid request body or empty array"}, "409": {Description: "One update failed; the whole batch was rolled back", Content: jsonBody(&openapi.Schema{Type: "array", Items: openapi.SchemaRef("BulkUpdateResult")})}, "500": {Description: "Internal error"}},
+	},
+	{"POST", "/author/photo/{id}"}: {
+		Summary:     "Upload an author's photo",
+		RequestBody: &openapi.RequestBody{Required: true, Content: map[string]openapi.MediaType{"multipart/form-data": {}}},
+		Responses:   map[string]openapi.Response{"200": okResponse, "400": {Description: "Invalid upload"}, "500": {Description: "Internal error"}},
+	},
+	{"GET", "/authorsbooks"}: {
+		Summary:   "List every author/book pair",
+		Responses: map[string]openapi.Response{"200": {Description: "OK", Content: jsonBody(openapi.ListSchema(openapi.SchemaRef("AuthorBook")))}},
+	},
+
+	{"GET", "/books"}: {
+		Summary:   "List books",
+		Responses: map[string]openapi.Response{"200": {Description: "OK", Content: jsonBody(openapi.ListSchema(openapi.SchemaRef("BookAuthorInfoView")))}},
+	},
+	{"GET", "/books/search"}: {
+		Summary:   "Search books by title, details or author",
+		Responses: map[string]openapi.Response{"200": {Description: "OK", Content: jsonBody(&openapi.Schema{Type: "array", Items: openapi.SchemaRef("BookAuthorInfoView")})}, "400": {Description: "Missing query parameter"}},
+	},
+	{"POST", "/books/new"}: {
+		Summary:     "Create a book",
+		RequestBody: &openapi.RequestBody{Required: true, Content: jsonBody(openapi.SchemaRef("Book"))},
+		Responses:   map[string]openapi.Response{"201": {Description: "Created"}, "400": {Description: "Invalid request body"}, "409": {Description: "Idempotency key reused with a different request body"}, "500": {Description: "Internal error"}},
+	},
+	{"GET", "/books/{id}"}: {
+		Summary:   "Get a book with its author's name",
+		Responses: map[string]openapi.Response{"200": {Description: "OK", Content: jsonBody(openapi.SchemaRef("BookAuthorInfoView"))}, "400": {Description: "Invalid book ID"}, "404": {Description: "Book not found"}},
+	},
+	{"PUT", "/books/{id}"}: {
+		Summary:     "Update a book",
+		RequestBody: &openapi.RequestBody{Required: true, Content: jsonBody(openapi.SchemaRef("Book"))},
+		Responses:   map[string]openapi.Response{"200": okResponse, "400": {Description: "Invalid request, or missing/malformed If-Match header"}, "409": {Description: "Version conflict: If-Match didn't match the book's current version; response body is the current book"}, "500": {Description: "Internal error"}},
+	},
+	{"PATCH", "/books/{id}"}: {
+		Summary:     "Partially update a book",
+		RequestBody: &openapi.RequestBody{Required: true, Content: jsonBody(&openapi.Schema{Type: "object"})},
+		Responses:   map[string]openapi.Response{"200": okResponse, "400": {Description: "Invalid request, empty/unrecognized body, or missing/malformed If-Match header"}, "409": {Description: "Version conflict: If-Match didn't match the book's current version; response body is the current book"}, "500": {Description: "Internal error"}},
+	},
+	{"DELETE", "/books/{id}"}: {
+		Summary:   "Delete a book",
+		Responses: map[string]openapi.Response{"200": okResponse, "400": {Description: "Invalid book ID"}, "500": {Description: "Internal error"}},
+	},
+	{"PUT", "/books"}: {
+		Summary:     "Bulk-update books transactionally",
+		RequestBody: &openapi.RequestBody{Required: true, Content: jsonBody(&openapi.Schema{Type: "array", Items: openapi.SchemaRef("Book")})},
+		Responses:   map[string]openapi.Response{"200": {Description: "All updates applied", Content: jsonBody(&openapi.Schema{Type: "array", Items: openapi.SchemaRef("BulkUpdateResult")})}, "400": {Description: "Invalid request body or empty array"}, "409": {Description: "One update failed; the whole batch was rolled back", Content: jsonBody(&openapi.Schema{Type: "array", Items: openapi.SchemaRef("BulkUpdateResult")})}, "500": {Description: "Internal error"}},
+	},
+	{"POST", "/books/photo/{id}"}: {
+		Summary:     "Upload a book's photo",
+		RequestBody: &openapi.RequestBody{Required: true, Content: map[string]openapi.MediaType{"multipart/form-data": {}}},
+		Responses:   map[string]openapi.Response{"200": okResponse, "400": {Description: "Invalid upload"}, "500": {Description: "Internal error"}},
+	},
+	{"POST", "/book/borrow"}: {
+		Summary:     "Borrow a book",
+		RequestBody: &openapi.RequestBody{Required: true, Content: jsonBody(&openapi.Schema{Type: "object", Properties: map[string]*openapi.Schema{"subscriber_id": {Type: "integer"}, "book_id": {Type: "integer"}}})},
+		Responses:   map[string]openapi.Response{"201": {Description: "Created"}, "400": {Description: "Invalid request body"}, "409": {Description: "Book already borrowed"}, "500": {Description: "Internal error"}},
+	},
+	{"POST", "/book/return"}: {
+		Summary:     "Return a borrowed book",
+		RequestBody: &openapi.RequestBody{Required: true, Content: jsonBody(&openapi.Schema{Type: "object", Properties: map[string]*openapi.Schema{"subscriber_id": {Type: "integer"}, "book_id": {Type: "integer"}}})},
+		Responses:   map[string]openapi.Response{"200": okResponse, "400": {Description: "Invalid request body"}, "409": {Description: "Book is not currently borrowed"}, "500": {Description: "Internal error"}},
+	},
+	{"POST", "/books/{id}/borrow"}: {
+		Summary:     "Borrow a book via the transactional loan workflow",
+		RequestBody: &openapi.RequestBody{Required: true, Content: jsonBody(&openapi.Schema{Type: "object", Properties: map[string]*openapi.Schema{"subscriber_id": {Type: "integer"}}})},
+		Responses:   map[string]openapi.Response{"201": {Description: "Created"}, "400": {Description: "Invalid request"}, "404": {Description: "Book not found"}, "409": {Description: "Book already borrowed"}, "500": {Description: "Internal error"}},
+	},
+	{"POST", "/loans/{id}/return"}: {
+		Summary:   "Return a loan",
+		Responses: map[string]openapi.Response{"200": okResponse, "400": {Description: "Invalid loan ID"}, "404": {Description: "Loan not found"}, "500": {Description: "Internal error"}},
+	},
+	{"GET", "/books/events"}: {
+		Summary:   "Stream book borrow/return/update activity as Server-Sent Events",
+		Responses: map[string]openapi.Response{"200": {Description: "OK: a continuous text/event-stream of {type, book_id, at} events; supports replay via the Last-Event-ID header"}},
+	},
+
+	{"GET", "/subscribers"}: {
+		Summary:   "List subscribers",
+		Responses: map[string]openapi.Response{"200": {Description: "OK", Content: jsonBody(openapi.ListSchema(openapi.SchemaRef("Subscriber")))}},
+	},
+	{"POST", "/subscribers/new"}: {
+		Summary:     "Create a subscriber",
+		RequestBody: &openapi.RequestBody{Required: true, Content: jsonBody(openapi.SchemaRef("Subscriber"))},
+		Responses:   map[string]openapi.Response{"201": {Description: "Created"}, "500": {Description: "Internal error"}},
+	},
+	{"GET", "/subscribers/{id}"}: {
+		Summary:   "List subscribers who have borrowed a book",
+		Responses: map[string]openapi.Response{"200": {Description: "OK", Content: jsonBody(&openapi.Schema{Type: "array", Items: openapi.SchemaRef("Subscriber")})}, "500": {Description: "Internal error"}},
+	},
+
+	{"GET", "/trash"}: {
+		Summary:   "List snapshots taken before author/book deletes",
+		Responses: map[string]openapi.Response{"200": {Description: "OK", Content: jsonBody(openapi.ListSchema(openapi.SchemaRef("BackupRecord")))}, "500": {Description: "Internal error"}},
+	},
+	{"POST", "/restore/{kind}/{id}"}: {
+		Summary:   "Reinsert a deleted author or book from its /trash snapshot",
+		Responses: map[string]openapi.Response{"200": okResponse, "400": {Description: "Invalid id or unknown kind"}, "404": {Description: "No snapshot found"}, "500": {Description: "Internal error"}},
+	},
+
+	{"POST", "/register"}: {
+		Summary:     "Register a subscriber account",
+		RequestBody: &openapi.RequestBody{Required: true, Content: jsonBody(&openapi.Schema{Type: "object", Properties: map[string]*openapi.Schema{"firstname": {Type: "string"}, "lastname": {Type: "string"}, "email": {Type: "string"}, "password": {Type: "string"}}})},
+		Responses:   map[string]openapi.Response{"201": {Description: "Created"}, "400": {Description: "Invalid request body"}, "500": {Description: "Internal error"}},
+	},
+	{"POST", "/login"}: {
+		Summary:     "Exchange credentials for a JWT",
+		RequestBody: &openapi.RequestBody{Required: true, Content: jsonBody(&openapi.Schema{Type: "object", Properties: map[string]*openapi.Schema{"email": {Type: "string"}, "password": {Type: "string"}}})},
+		Responses:   map[string]openapi.Response{"200": {Description: "OK", Content: jsonBody(&openapi.Schema{Type: "object", Properties: map[string]*openapi.Schema{"token": {Type: "string"}}})}, "400": {Description: "Invalid request body"}, "401": {Description: "Invalid email or password"}, "500": {Description: "Internal error"}},
+	},
+}
+
+// buildOpenAPISpec walks router's registered routes and assembles an
+// OpenAPI 3.0 document describing every one that has an entry in
+// routeDocs, with schemas derived from the API's request/response
+// structs.
+func buildOpenAPISpec(router *mux.Router) (*openapi.Document, error) {
+	doc := openapi.NewDocument("Library API", "1.0.0")
+	doc.AddSchema("Author", Author{})
+	doc.AddSchema("AuthorView", AuthorView{})
+	doc.AddSchema("Book", Book{})
+	doc.AddSchema("Subscriber", Subscriber{})
+	doc.AddSchema("BookAuthorInfo", BookAuthorInfo{})
+	doc.AddSchema("BookAuthorInfoView", BookAuthorInfoView{})
+	doc.AddSchema("AuthorBook", AuthorBook{})
+	doc.AddSchema("BackupRecord", backup.Record{})
+	doc.AddSchema("BulkUpdateResult", BulkUpdateResult{})
+
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+
+		for _, method := range methods {
+			op, ok := routeDocs[routeKey{strings.ToUpper(method), path}]
+			if !ok {
+				continue
+			}
+			doc.AddRoute(method, path, op)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
+// OpenAPIJSON serves the OpenAPI 3.0 document describing this API's
+// routes, built once at startup from the registered mux routes.
+func (app *App) OpenAPIJSON(w http.ResponseWriter, r *http.Request) {
+	if app.OpenAPISpec == nil {
+		HandleError(w, r, app.Logger, "OpenAPI spec not available", nil, http.StatusInternalServerError)
+		return
+	}
+	RespondWithJSON(w, r, http.StatusOK, app.OpenAPISpec)
+}
+
+// swaggerUIPage renders Swagger UI against /openapi.json using the
+// swagger-ui-dist CDN bundle, so the API doesn't need to vendor its
+// static assets.
+const swaggerUIPage = `<!DOCTYPE html>
+<html>
+<head>
+	<title>Library API docs</title>
+	<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist/swagger-ui.css">
+</head>
+<body>
+	<div id="swagger-ui"></div>
+	<script src="https://unpkg.com/swagger-ui-dist/swagger-ui-bundle.js"></script>
+	<script>
+		window.onload = function() {
+			SwaggerUIBundle({ url: "/openapi.json", dom_id: "#swagger-ui" });
+		};
+	</script>
+</body>
+</html>
+`
+
+// SwaggerUI serves a Swagger UI page that renders the OpenAPI document
+// from /openapi.json.
+func (app *App) SwaggerUI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, swaggerUIPage)
+}
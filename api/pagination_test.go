@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/CristyNel/library/api/querybuilder"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestGetAllBooks_AppliesSortFilterAndPage verifies that GetAllBooks
+// translates its query parameters into the expected WHERE/ORDER
+// BY/LIMIT/OFFSET SQL, and that the response envelope and Link header
+// reflect the requested page.
+func TestGetAllBooks_AppliesSortFilterAndPage(t *testing.T) {
+	app, mock := createTestApp(t)
+	defer app.DB.Close()
+
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM books JOIN authors ON books.author_id = authors.id WHERE books.title LIKE \? AND books.is_borrowed = \?`).
+		WithArgs("%Sample%", true).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(25))
+
+	rows := sqlmock.NewRows([]string{
+		"book_id", "book_title", "author_id", "book_photo", "is_borrowed", "book_details", "author_lastname", "author_firstname",
+	}).AddRow(3, "Sample Book", 1, "book.jpg", true, "A sample book", "Doe", "John")
+
+	mock.ExpectQuery(`SELECT (.+) FROM books JOIN authors ON books.author_id = authors.id WHERE books.title LIKE \? AND books.is_borrowed = \? ORDER BY books.title DESC LIMIT \? OFFSET \?`).
+		WithArgs("%Sample%", true, 10, 10).
+		WillReturnRows(rows)
+
+	req := httptest.NewRequest("GET", "/books?title_like=Sample&is_borrowed=true&sort=-title&page=2&page_size=10", nil)
+	rr := httptest.NewRecorder()
+	app.GetAllBooks(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var resp ListResponse
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+	assert.Equal(t, 2, resp.Page)
+	assert.Equal(t, 10, resp.PageSize)
+	assert.Equal(t, 25, resp.Total)
+	assert.NotEmpty(t, resp.Next)
+	assert.Contains(t, rr.Header().Get("Link"), `rel="next"`)
+	assert.Contains(t, rr.Header().Get("Link"), `rel="prev"`)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestGetAllBooks_InvalidSortFieldReturns400 verifies that an
+// unwhitelisted "sort" field is rejected before any query runs.
+func TestGetAllBooks_InvalidSortFieldReturns400(t *testing.T) {
+	app, mock := createTestApp(t)
+	defer app.DB.Close()
+
+	req := httptest.NewRequest("GET", "/books?sort=secret_column", nil)
+	rr := httptest.NewRecorder()
+	app.GetAllBooks(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestGetAllBooks_InvalidPageSizeReturns400 verifies that a non-numeric
+// "page" value is rejected before any query runs.
+func TestGetAllBooks_InvalidPageSizeReturns400(t *testing.T) {
+	app, mock := createTestApp(t)
+	defer app.DB.Close()
+
+	req := httptest.NewRequest("GET", "/books?page=not-a-number", nil)
+	rr := httptest.NewRecorder()
+	app.GetAllBooks(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestGetAllBooks_PageSizeCappedAtMax verifies that a page_size above
+// querybuilder.MaxPageSize is capped rather than rejected.
+func TestGetAllBooks_PageSizeCappedAtMax(t *testing.T) {
+	app, mock := createTestApp(t)
+	defer app.DB.Close()
+
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM books JOIN authors ON books.author_id = authors.id`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(`SELECT (.+) FROM books JOIN authors ON books.author_id = authors.id ORDER BY books.id LIMIT \? OFFSET \?`).
+		WithArgs(querybuilder.MaxPageSize, 0).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"book_id", "book_title", "author_id", "book_photo", "is_borrowed", "book_details", "author_lastname", "author_firstname",
+		}))
+
+	req := httptest.NewRequest("GET", "/books?page_size=500", nil)
+	rr := httptest.NewRecorder()
+	app.GetAllBooks(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestGetAuthors_InvalidAuthorIDFilterReturns400 verifies that
+// GetAuthorsAndBooks rejects a non-numeric author_id filter with a 400
+// rather than passing it through to SQL.
+func TestGetAuthorsAndBooks_InvalidAuthorIDFilterReturns400(t *testing.T) {
+	app, mock := createTestApp(t)
+	defer app.DB.Close()
+
+	req := httptest.NewRequest("GET", "/authorsbooks?author_id=not-a-number", nil)
+	rr := httptest.NewRecorder()
+	app.GetAuthorsAndBooks(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,116 @@
+// Package querybuilder assembles the parameterized WHERE, ORDER BY and
+// LIMIT/OFFSET fragments for list endpoints, so client-supplied sort and
+// filter parameters never reach a query string unescaped.
+package querybuilder
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidSort means a "sort" parameter named a field that isn't on the
+// resource's sort whitelist.
+var ErrInvalidSort = errors.New("querybuilder: invalid sort field")
+
+// DefaultPageSize is used when the client omits "page_size".
+const DefaultPageSize = 20
+
+// MaxPageSize is the largest "page_size" a client may request; larger
+// values are capped rather than rejected.
+const MaxPageSize = 100
+
+// Page is a validated, 1-based page number and page size.
+type Page struct {
+	Number int
+	Size   int
+}
+
+// Offset returns the SQL OFFSET corresponding to p.
+func (p Page) Offset() int {
+	return (p.Number - 1) * p.Size
+}
+
+// ParsePage reads "page" and "page_size" from values, defaulting to page 1
+// and DefaultPageSize and capping page_size at MaxPageSize.
+func ParsePage(values url.Values) (Page, error) {
+	page := 1
+	if raw := values.Get("page"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			return Page{}, fmt.Errorf("invalid page: %q", raw)
+		}
+		page = n
+	}
+
+	size := DefaultPageSize
+	if raw := values.Get("page_size"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			return Page{}, fmt.Errorf("invalid page_size: %q", raw)
+		}
+		size = n
+	}
+	if size > MaxPageSize {
+		size = MaxPageSize
+	}
+
+	return Page{Number: page, Size: size}, nil
+}
+
+// ParseSort turns a comma-separated "sort" value such as "title,-author_id"
+// into an ORDER BY clause, without the "ORDER BY" keywords. Each field is
+// translated through whitelist, which maps the external field name to the
+// SQL column or expression it sorts by; a leading "-" sorts that field
+// descending. An empty raw value yields an empty clause. A field absent
+// from whitelist returns ErrInvalidSort, so callers can report a 400.
+func ParseSort(raw string, whitelist map[string]string) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+
+	var clauses []string
+	for _, field := range strings.Split(raw, ",") {
+		direction := "ASC"
+		if strings.HasPrefix(field, "-") {
+			direction = "DESC"
+			field = field[1:]
+		}
+
+		column, ok := whitelist[field]
+		if !ok {
+			return "", fmt.Errorf("%w: %q", ErrInvalidSort, field)
+		}
+
+		clauses = append(clauses, column+" "+direction)
+	}
+
+	return strings.Join(clauses, ", "), nil
+}
+
+// Filter is one parameterized WHERE fragment, e.g. Clause "title LIKE ?"
+// with Args []interface{}{"%foo%"}.
+type Filter struct {
+	Clause string
+	Args   []interface{}
+}
+
+// Where joins filters with AND, returning the combined SQL fragment
+// (without the "WHERE" keyword, empty if filters is empty) and the
+// flattened, correctly ordered argument list.
+func Where(filters ...Filter) (string, []interface{}) {
+	if len(filters) == 0 {
+		return "", nil
+	}
+
+	clauses := make([]string, len(filters))
+	var args []interface{}
+	for i, f := range filters {
+		clauses[i] = f.Clause
+		args = append(args, f.Args...)
+	}
+
+	return strings.Join(clauses, " AND "), args
+}
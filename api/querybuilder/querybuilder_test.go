@@ -0,0 +1,72 @@
+package querybuilder
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePage_Defaults(t *testing.T) {
+	page, err := ParsePage(url.Values{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, Page{Number: 1, Size: DefaultPageSize}, page)
+	assert.Equal(t, 0, page.Offset())
+}
+
+func TestParsePage_CapsPageSize(t *testing.T) {
+	page, err := ParsePage(url.Values{"page": {"2"}, "page_size": {"500"}})
+
+	assert.NoError(t, err)
+	assert.Equal(t, Page{Number: 2, Size: MaxPageSize}, page)
+	assert.Equal(t, MaxPageSize, page.Offset())
+}
+
+func TestParsePage_RejectsInvalidValues(t *testing.T) {
+	_, err := ParsePage(url.Values{"page": {"0"}})
+	assert.Error(t, err)
+
+	_, err = ParsePage(url.Values{"page_size": {"abc"}})
+	assert.Error(t, err)
+}
+
+func TestParseSort_EmptyYieldsEmptyClause(t *testing.T) {
+	clause, err := ParseSort("", map[string]string{"title": "books.title"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "", clause)
+}
+
+func TestParseSort_TranslatesWhitelistedFields(t *testing.T) {
+	whitelist := map[string]string{"title": "books.title", "author_id": "books.author_id"}
+
+	clause, err := ParseSort("title,-author_id", whitelist)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "books.title ASC, books.author_id DESC", clause)
+}
+
+func TestParseSort_RejectsFieldNotOnWhitelist(t *testing.T) {
+	_, err := ParseSort("secret_column", map[string]string{"title": "books.title"})
+
+	assert.True(t, errors.Is(err, ErrInvalidSort))
+}
+
+func TestWhere_JoinsFiltersWithAndAndFlattensArgs(t *testing.T) {
+	clause, args := Where(
+		Filter{Clause: "title LIKE ?", Args: []interface{}{"%foo%"}},
+		Filter{Clause: "author_id = ?", Args: []interface{}{7}},
+	)
+
+	assert.Equal(t, "title LIKE ? AND author_id = ?", clause)
+	assert.Equal(t, []interface{}{"%foo%", 7}, args)
+}
+
+func TestWhere_NoFiltersYieldsEmptyClause(t *testing.T) {
+	clause, args := Where()
+
+	assert.Equal(t, "", clause)
+	assert.Nil(t, args)
+}
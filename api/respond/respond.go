@@ -0,0 +1,204 @@
+// Package respond writes a payload to an http.ResponseWriter in whichever
+// format the request's Accept header asks for (JSON, XML, or CSV),
+// transparently gzip/deflate-compressing the body when Accept-Encoding
+// allows it.
+package respond
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// Format identifies the body encoding Negotiate picked for a request.
+type Format int
+
+const (
+	FormatJSON Format = iota
+	FormatXML
+	FormatCSV
+)
+
+// Negotiate inspects r's Accept header and reports which Format Write
+// would use for it. FormatJSON is the default when Accept is absent or
+// names none of the supported types.
+func Negotiate(r *http.Request) Format {
+	if r == nil {
+		return FormatJSON
+	}
+
+	accept := r.Header.Get("Accept")
+	switch {
+	case strings.Contains(accept, "text/csv"):
+		return FormatCSV
+	case strings.Contains(accept, "application/xml"), strings.Contains(accept, "text/xml"):
+		return FormatXML
+	default:
+		return FormatJSON
+	}
+}
+
+// Write encodes payload as JSON, XML, or CSV depending on r's Accept
+// header, compresses it with gzip or deflate when r's Accept-Encoding
+// header allows, and writes it to w with the given status code.
+//
+// CSV only applies to slice payloads: each element's exported fields
+// (named after their json tags) become a column, and rows are streamed
+// to w one at a time rather than buffered, with a Content-Disposition
+// header naming the download after the element type. A non-slice
+// payload falls back to JSON even when CSV was requested.
+func Write(w http.ResponseWriter, r *http.Request, status int, payload interface{}) error {
+	w.Header().Set("Vary", "Accept, Accept-Encoding")
+
+	format := Negotiate(r)
+	if format == FormatCSV {
+		if ok, err := writeCSV(w, r, status, payload); ok {
+			return err
+		}
+		format = FormatJSON
+	}
+
+	var body []byte
+	var err error
+	switch format {
+	case FormatXML:
+		w.Header().Set("Content-Type", "application/xml")
+		body, err = xml.Marshal(payload)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		body, err = json.Marshal(payload)
+	}
+	if err != nil {
+		return err
+	}
+
+	out, closeOut := compressedWriter(w, r)
+	w.WriteHeader(status)
+	_, werr := out.Write(body)
+	if cerr := closeOut(); werr == nil {
+		werr = cerr
+	}
+	return werr
+}
+
+// compressedWriter wraps w in a gzip or deflate compressor when r's
+// Accept-Encoding header asks for one, setting the Content-Encoding
+// header accordingly. The returned func flushes and closes the
+// compressor; it is a no-op when no compression was negotiated.
+func compressedWriter(w http.ResponseWriter, r *http.Request) (io.Writer, func() error) {
+	encoding := r.Header.Get("Accept-Encoding")
+	switch {
+	case strings.Contains(encoding, "gzip"):
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		return gz, gz.Close
+	case strings.Contains(encoding, "deflate"):
+		w.Header().Set("Content-Encoding", "deflate")
+		fl, _ := flate.NewWriter(w, flate.DefaultCompression)
+		return fl, fl.Close
+	default:
+		return w, func() error { return nil }
+	}
+}
+
+// writeCSV streams payload as CSV if it's a slice, reporting ok=false
+// (without writing anything) when it isn't, so the caller can fall back
+// to another format.
+func writeCSV(w http.ResponseWriter, r *http.Request, status int, payload interface{}) (ok bool, err error) {
+	v := reflect.ValueOf(payload)
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Slice {
+		return false, nil
+	}
+
+	elemType := v.Type().Elem()
+	for elemType.Kind() == reflect.Ptr {
+		elemType = elemType.Elem()
+	}
+	if elemType.Kind() != reflect.Struct {
+		return false, nil
+	}
+
+	fields := csvFields(elemType)
+	columns := make([]string, len(fields))
+	for i, f := range fields {
+		columns[i] = csvColumnName(f)
+	}
+
+	// A "View" suffix marks a type that exists only to control wire
+	// representation (e.g. AuthorView rendering a hashid token instead of
+	// the internal Author's raw primary key); the download name should
+	// still read "authors.csv", not "authorviews.csv".
+	name := strings.ToLower(strings.TrimSuffix(elemType.Name(), "View"))
+	filename := name + "s.csv"
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+	out, closeOut := compressedWriter(w, r)
+	w.WriteHeader(status)
+	defer func() {
+		if cerr := closeOut(); err == nil {
+			err = cerr
+		}
+	}()
+
+	cw := csv.NewWriter(out)
+	if err = cw.Write(columns); err != nil {
+		return true, err
+	}
+
+	row := make([]string, len(fields))
+	for i := 0; i < v.Len(); i++ {
+		elem := v.Index(i)
+		for elem.Kind() == reflect.Ptr {
+			elem = elem.Elem()
+		}
+		for j, f := range fields {
+			row[j] = fmt.Sprint(elem.FieldByIndex(f.Index).Interface())
+		}
+		if err = cw.Write(row); err != nil {
+			return true, err
+		}
+		cw.Flush()
+		if err = cw.Error(); err != nil {
+			return true, err
+		}
+	}
+
+	return true, nil
+}
+
+// csvFields returns t's exported, non-"-" fields in declaration order.
+func csvFields(t reflect.Type) []reflect.StructField {
+	var fields []reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		if f.Tag.Get("json") == "-" {
+			continue
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// csvColumnName returns f's CSV column header: its json tag name, or its
+// Go field name when the field has no json tag.
+func csvColumnName(f reflect.StructField) string {
+	name := strings.Split(f.Tag.Get("json"), ",")[0]
+	if name == "" {
+		name = f.Name
+	}
+	return name
+}
@@ -0,0 +1,105 @@
+package respond
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type widget struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestWrite_DefaultsToJSON(t *testing.T) {
+	r := httptest.NewRequest("GET", "/widgets", nil)
+	w := httptest.NewRecorder()
+
+	assert.NoError(t, Write(w, r, 200, widget{ID: 1, Name: "sprocket"}))
+
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var got widget
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.Equal(t, widget{ID: 1, Name: "sprocket"}, got)
+}
+
+func TestWrite_XML(t *testing.T) {
+	r := httptest.NewRequest("GET", "/widgets", nil)
+	r.Header.Set("Accept", "application/xml")
+	w := httptest.NewRecorder()
+
+	assert.NoError(t, Write(w, r, 200, widget{ID: 1, Name: "sprocket"}))
+
+	assert.Equal(t, "application/xml", w.Header().Get("Content-Type"))
+	var got widget
+	assert.NoError(t, xml.Unmarshal(w.Body.Bytes(), &got))
+	assert.Equal(t, widget{ID: 1, Name: "sprocket"}, got)
+}
+
+func TestWrite_CSVStreamsSliceRows(t *testing.T) {
+	r := httptest.NewRequest("GET", "/widgets", nil)
+	r.Header.Set("Accept", "text/csv")
+	w := httptest.NewRecorder()
+
+	widgets := []widget{{ID: 1, Name: "sprocket"}, {ID: 2, Name: "cog"}}
+	assert.NoError(t, Write(w, r, 200, widgets))
+
+	assert.Equal(t, "text/csv", w.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="widgets.csv"`, w.Header().Get("Content-Disposition"))
+
+	rows, err := csv.NewReader(w.Body).ReadAll()
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{
+		{"id", "name"},
+		{"1", "sprocket"},
+		{"2", "cog"},
+	}, rows)
+}
+
+func TestWrite_CSVFallsBackToJSONForNonSlicePayload(t *testing.T) {
+	r := httptest.NewRequest("GET", "/widgets/1", nil)
+	r.Header.Set("Accept", "text/csv")
+	w := httptest.NewRecorder()
+
+	assert.NoError(t, Write(w, r, 200, widget{ID: 1, Name: "sprocket"}))
+
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+}
+
+func TestWrite_GzipNegotiation(t *testing.T) {
+	r := httptest.NewRequest("GET", "/widgets", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+
+	assert.NoError(t, Write(w, r, 200, widget{ID: 1, Name: "sprocket"}))
+
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+
+	gz, err := gzip.NewReader(w.Body)
+	assert.NoError(t, err)
+	raw, err := io.ReadAll(gz)
+	assert.NoError(t, err)
+
+	var got widget
+	assert.NoError(t, json.Unmarshal(raw, &got))
+	assert.Equal(t, widget{ID: 1, Name: "sprocket"}, got)
+}
+
+func TestNegotiate_PrefersCSVThenXMLThenJSON(t *testing.T) {
+	csvReq := httptest.NewRequest("GET", "/", nil)
+	csvReq.Header.Set("Accept", "text/csv")
+	assert.Equal(t, FormatCSV, Negotiate(csvReq))
+
+	xmlReq := httptest.NewRequest("GET", "/", nil)
+	xmlReq.Header.Set("Accept", "application/xml")
+	assert.Equal(t, FormatXML, Negotiate(xmlReq))
+
+	plainReq := httptest.NewRequest("GET", "/", nil)
+	assert.Equal(t, FormatJSON, Negotiate(plainReq))
+}
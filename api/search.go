@@ -0,0 +1,412 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const (
+	defaultPerPage = 20
+	maxPerPage     = 100
+)
+
+// SearchQuery describes a filtered, paginated full-text search request
+// against books or authors.
+type SearchQuery struct {
+	Q        string
+	Fields   []string // subset of "title", "author", "details"
+	Page     int
+	PerPage  int
+	Sort     string // "relevance", "title", "author"
+	Borrowed *bool
+	AuthorID int
+}
+
+// ParseSearchQuery builds a SearchQuery from request query parameters.
+func ParseSearchQuery(values url.Values) SearchQuery {
+	q := SearchQuery{
+		Q:       strings.TrimSpace(values.Get("q")),
+		Sort:    values.Get("sort"),
+		Page:    atoiOrDefault(values.Get("page"), 1),
+		PerPage: atoiOrDefault(values.Get("perPage"), defaultPerPage),
+	}
+
+	if fields := values.Get("fields"); fields != "" {
+		q.Fields = strings.Split(fields, ",")
+	}
+
+	if borrowed := values.Get("borrowed"); borrowed != "" {
+		b := borrowed == "true"
+		q.Borrowed = &b
+	}
+
+	if authorID := values.Get("authorID"); authorID != "" {
+		if id, err := strconv.Atoi(authorID); err == nil {
+			q.AuthorID = id
+		}
+	}
+
+	return q
+}
+
+func atoiOrDefault(s string, fallback int) int {
+	if v, err := strconv.Atoi(s); err == nil {
+		return v
+	}
+	return fallback
+}
+
+func (q *SearchQuery) normalize() {
+	if q.Page < 1 {
+		q.Page = 1
+	}
+	if q.PerPage <= 0 {
+		q.PerPage = defaultPerPage
+	}
+	if q.PerPage > maxPerPage {
+		q.PerPage = maxPerPage
+	}
+}
+
+func (q SearchQuery) wantsField(name string) bool {
+	if len(q.Fields) == 0 {
+		return true
+	}
+	for _, f := range q.Fields {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (q SearchQuery) offset() int {
+	return (q.Page - 1) * q.PerPage
+}
+
+// BookSearchResult is the paginated envelope returned by SearchService.SearchBooks.
+type BookSearchResult struct {
+	Items   []BookAuthorInfo `json:"items"`
+	Total   int              `json:"total"`
+	Page    int              `json:"page"`
+	PerPage int              `json:"perPage"`
+}
+
+// BookSearchResultView is BookSearchResult's wire representation, with each
+// item's IDs rendered as hashid tokens the same way GetAllBooks does.
+type BookSearchResultView struct {
+	Items   []BookAuthorInfoView `json:"items"`
+	Total   int                  `json:"total"`
+	Page    int                  `json:"page"`
+	PerPage int                  `json:"perPage"`
+}
+
+// newBookSearchResultView converts r to its wire representation.
+func newBookSearchResultView(r *BookSearchResult) BookSearchResultView {
+	return BookSearchResultView{
+		Items:   newBookAuthorInfoViews(r.Items),
+		Total:   r.Total,
+		Page:    r.Page,
+		PerPage: r.PerPage,
+	}
+}
+
+// AuthorSearchResult is the paginated envelope returned by SearchService.SearchAuthors.
+type AuthorSearchResult struct {
+	Items   []Author `json:"items"`
+	Total   int      `json:"total"`
+	Page    int      `json:"page"`
+	PerPage int      `json:"perPage"`
+}
+
+// AuthorSearchResultView is AuthorSearchResult's wire representation, with
+// each item's ID rendered as a hashid token the same way GetAuthors does.
+type AuthorSearchResultView struct {
+	Items   []AuthorView `json:"items"`
+	Total   int          `json:"total"`
+	Page    int          `json:"page"`
+	PerPage int          `json:"perPage"`
+}
+
+// newAuthorSearchResultView converts r to its wire representation.
+func newAuthorSearchResultView(r *AuthorSearchResult) AuthorSearchResultView {
+	return AuthorSearchResultView{
+		Items:   newAuthorViews(r.Items),
+		Total:   r.Total,
+		Page:    r.Page,
+		PerPage: r.PerPage,
+	}
+}
+
+// SearchService runs ranked, filtered, paginated searches over books and
+// authors. It prefers MySQL FULLTEXT matching and falls back to LIKE when
+// the server reports no FULLTEXT index is available (error 1191).
+type SearchService struct {
+	DB *sql.DB
+}
+
+// NewSearchService wraps db in a SearchService.
+func NewSearchService(db *sql.DB) *SearchService {
+	return &SearchService{DB: db}
+}
+
+func isFullTextUnavailable(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if ok := asMySQLError(err, &mysqlErr); ok {
+		return mysqlErr.Number == 1191
+	}
+	return false
+}
+
+func asMySQLError(err error, target **mysql.MySQLError) bool {
+	if me, ok := err.(*mysql.MySQLError); ok {
+		*target = me
+		return true
+	}
+	return false
+}
+
+// booksFilter builds the WHERE clause and args shared by the FULLTEXT and
+// LIKE variants of the books search, excluding the free-text condition.
+func (q SearchQuery) booksFilter() (conditions []string, args []interface{}) {
+	if q.AuthorID != 0 {
+		conditions = append(conditions, "books.author_id = ?")
+		args = append(args, q.AuthorID)
+	}
+	if q.Borrowed != nil {
+		conditions = append(conditions, "books.is_borrowed = ?")
+		args = append(args, *q.Borrowed)
+	}
+	return conditions, args
+}
+
+func (q SearchQuery) booksTextConditionFullText() (string, []interface{}) {
+	var parts []string
+	var args []interface{}
+
+	if q.wantsField("title") || q.wantsField("details") {
+		parts = append(parts, "MATCH(books.title, books.details) AGAINST (? IN NATURAL LANGUAGE MODE)")
+		args = append(args, q.Q)
+	}
+	if q.wantsField("author") {
+		parts = append(parts, "MATCH(authors.Lastname, authors.Firstname) AGAINST (? IN NATURAL LANGUAGE MODE)")
+		args = append(args, q.Q)
+	}
+
+	return strings.Join(parts, " OR "), args
+}
+
+func (q SearchQuery) booksTextConditionLike() (string, []interface{}) {
+	like := "%" + q.Q + "%"
+	var parts []string
+	var args []interface{}
+
+	if q.wantsField("title") {
+		parts = append(parts, "books.title LIKE ?")
+		args = append(args, like)
+	}
+	if q.wantsField("details") {
+		parts = append(parts, "books.details LIKE ?")
+		args = append(args, like)
+	}
+	if q.wantsField("author") {
+		parts = append(parts, "authors.Lastname LIKE ?")
+		args = append(args, like)
+	}
+
+	return strings.Join(parts, " OR "), args
+}
+
+func (q SearchQuery) booksOrderBy(fullText bool) string {
+	switch q.Sort {
+	case "title":
+		return "books.title"
+	case "author":
+		return "authors.Lastname, authors.Firstname"
+	case "relevance":
+		if fullText && q.Q != "" {
+			return "MATCH(books.title, books.details) AGAINST (? IN NATURAL LANGUAGE MODE) DESC"
+		}
+		return "books.title"
+	default:
+		return "books.title"
+	}
+}
+
+func (q SearchQuery) buildBooksQuery(fullText bool) (listSQL string, listArgs []interface{}, countSQL string, countArgs []interface{}) {
+	conditions, filterArgs := q.booksFilter()
+
+	var textArgs []interface{}
+	if q.Q != "" {
+		var textCondition string
+		if fullText {
+			textCondition, textArgs = q.booksTextConditionFullText()
+		} else {
+			textCondition, textArgs = q.booksTextConditionLike()
+		}
+		if textCondition != "" {
+			conditions = append([]string{"(" + textCondition + ")"}, conditions...)
+		}
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	base := "SELECT books.id AS book_id, books.title AS book_title, books.author_id AS author_id, books.photo AS book_photo, " +
+		"books.is_borrowed AS is_borrowed, books.details AS book_details, authors.Lastname AS author_lastname, authors.Firstname AS author_firstname " +
+		"FROM books JOIN authors ON books.author_id = authors.id" + where
+
+	orderBy := q.booksOrderBy(fullText)
+	orderArgs := []interface{}{}
+	if q.Sort == "relevance" && fullText && q.Q != "" {
+		orderArgs = append(orderArgs, q.Q)
+	}
+
+	listArgs = append(listArgs, textArgs...)
+	listArgs = append(listArgs, filterArgs...)
+	listArgs = append(listArgs, orderArgs...)
+	listArgs = append(listArgs, q.PerPage, q.offset())
+
+	listSQL = fmt.Sprintf("%s ORDER BY %s LIMIT ? OFFSET ?", base, orderBy)
+
+	countSQL = "SELECT COUNT(*) FROM books JOIN authors ON books.author_id = authors.id" + where
+	countArgs = append(countArgs, textArgs...)
+	countArgs = append(countArgs, filterArgs...)
+
+	return listSQL, listArgs, countSQL, countArgs
+}
+
+// SearchBooks runs a ranked, filtered, paginated search over books.
+func (s *SearchService) SearchBooks(ctx context.Context, q SearchQuery) (*BookSearchResult, error) {
+	q.normalize()
+
+	listSQL, listArgs, countSQL, countArgs := q.buildBooksQuery(true)
+	rows, err := s.DB.QueryContext(ctx, listSQL, listArgs...)
+	if err != nil && isFullTextUnavailable(err) {
+		listSQL, listArgs, countSQL, countArgs = q.buildBooksQuery(false)
+		rows, err = s.DB.QueryContext(ctx, listSQL, listArgs...)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := ScanBooks(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	var total int
+	if err := s.DB.QueryRowContext(ctx, countSQL, countArgs...).Scan(&total); err != nil {
+		return nil, err
+	}
+
+	return &BookSearchResult{Items: items, Total: total, Page: q.Page, PerPage: q.PerPage}, nil
+}
+
+func (q SearchQuery) authorsTextConditionFullText() (string, []interface{}) {
+	if q.Q == "" {
+		return "", nil
+	}
+	return "MATCH(Lastname, Firstname) AGAINST (? IN NATURAL LANGUAGE MODE)", []interface{}{q.Q}
+}
+
+func (q SearchQuery) authorsTextConditionLike() (string, []interface{}) {
+	if q.Q == "" {
+		return "", nil
+	}
+	like := "%" + q.Q + "%"
+	return "Firstname LIKE ? OR Lastname LIKE ?", []interface{}{like, like}
+}
+
+func (q SearchQuery) authorsOrderBy() string {
+	switch q.Sort {
+	case "title", "author":
+		return "Lastname, Firstname"
+	default:
+		return "Lastname, Firstname"
+	}
+}
+
+func (q SearchQuery) buildAuthorsQuery(fullText bool) (listSQL string, listArgs []interface{}, countSQL string, countArgs []interface{}) {
+	var condition string
+	var args []interface{}
+	if fullText {
+		condition, args = q.authorsTextConditionFullText()
+	} else {
+		condition, args = q.authorsTextConditionLike()
+	}
+
+	where := ""
+	if condition != "" {
+		where = " WHERE " + condition
+	}
+
+	base := "SELECT id, lastname, firstname, photo FROM authors" + where
+	orderBy := q.authorsOrderBy()
+
+	listSQL = fmt.Sprintf("%s ORDER BY %s LIMIT ? OFFSET ?", base, orderBy)
+	listArgs = append(append([]interface{}{}, args...), q.PerPage, q.offset())
+
+	countSQL = "SELECT COUNT(*) FROM authors" + where
+	countArgs = args
+
+	return listSQL, listArgs, countSQL, countArgs
+}
+
+// SearchAuthors runs a ranked, filtered, paginated search over authors.
+func (s *SearchService) SearchAuthors(ctx context.Context, q SearchQuery) (*AuthorSearchResult, error) {
+	q.normalize()
+
+	listSQL, listArgs, countSQL, countArgs := q.buildAuthorsQuery(true)
+	rows, err := s.DB.QueryContext(ctx, listSQL, listArgs...)
+	if err != nil && isFullTextUnavailable(err) {
+		listSQL, listArgs, countSQL, countArgs = q.buildAuthorsQuery(false)
+		rows, err = s.DB.QueryContext(ctx, listSQL, listArgs...)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := ScanAuthors(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	var total int
+	if err := s.DB.QueryRowContext(ctx, countSQL, countArgs...).Scan(&total); err != nil {
+		return nil, err
+	}
+
+	return &AuthorSearchResult{Items: items, Total: total, Page: q.Page, PerPage: q.PerPage}, nil
+}
+
+// SearchBooksRanked serves GET /api/v1/search/books.
+func (app *App) SearchBooksRanked(w http.ResponseWriter, r *http.Request) {
+	service := NewSearchService(app.DB)
+	result, err := service.SearchBooks(r.Context(), ParseSearchQuery(r.URL.Query()))
+	if err != nil {
+		HandleError(w, r, app.Logger, "Error searching books", err, http.StatusInternalServerError)
+		return
+	}
+	RespondWithJSON(w, r, http.StatusOK, newBookSearchResultView(result))
+}
+
+// SearchAuthorsRanked serves GET /api/v1/search/authors.
+func (app *App) SearchAuthorsRanked(w http.ResponseWriter, r *http.Request) {
+	service := NewSearchService(app.DB)
+	result, err := service.SearchAuthors(r.Context(), ParseSearchQuery(r.URL.Query()))
+	if err != nil {
+		HandleError(w, r, app.Logger, "Error searching authors", err, http.StatusInternalServerError)
+		return
+	}
+	RespondWithJSON(w, r, http.StatusOK, newAuthorSearchResultView(result))
+}
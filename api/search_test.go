@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchQuery_Normalize(t *testing.T) {
+	q := SearchQuery{Page: 0, PerPage: 0}
+	q.normalize()
+	assert.Equal(t, 1, q.Page)
+	assert.Equal(t, defaultPerPage, q.PerPage)
+
+	q = SearchQuery{Page: -5, PerPage: 1000}
+	q.normalize()
+	assert.Equal(t, 1, q.Page)
+	assert.Equal(t, maxPerPage, q.PerPage)
+}
+
+func TestParseSearchQuery(t *testing.T) {
+	values := httptest.NewRequest("GET", "/api/v1/search/books?q=tolkien&fields=title,author&page=2&perPage=10&sort=relevance&borrowed=true&authorID=7", nil).URL.Query()
+
+	q := ParseSearchQuery(values)
+
+	assert.Equal(t, "tolkien", q.Q)
+	assert.Equal(t, []string{"title", "author"}, q.Fields)
+	assert.Equal(t, 2, q.Page)
+	assert.Equal(t, 10, q.PerPage)
+	assert.Equal(t, "relevance", q.Sort)
+	assert.Equal(t, 7, q.AuthorID)
+	if assert.NotNil(t, q.Borrowed) {
+		assert.True(t, *q.Borrowed)
+	}
+}
+
+func TestSearchService_SearchBooks_FullText(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{
+		"book_id", "book_title", "author_id", "book_photo", "is_borrowed", "book_details", "author_lastname", "author_firstname",
+	}).AddRow(1, "The Hobbit", 1, "hobbit.jpg", false, "A hobbit's journey", "Tolkien", "J.R.R.")
+
+	mock.ExpectQuery(`MATCH\(books.title, books.details\) AGAINST`).
+		WithArgs("hobbit", "hobbit", 20, 0).
+		WillReturnRows(rows)
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM books`).
+		WithArgs("hobbit", "hobbit").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	service := NewSearchService(db)
+	result, err := service.SearchBooks(context.Background(), SearchQuery{Q: "hobbit"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.Total)
+	assert.Equal(t, 1, len(result.Items))
+	assert.Equal(t, "The Hobbit", result.Items[0].BookTitle)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSearchService_SearchBooks_FallsBackToLike(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery(`MATCH\(books.title, books.details\) AGAINST`).
+		WithArgs("hobbit", "hobbit", 20, 0).
+		WillReturnError(&mysql.MySQLError{Number: 1191, Message: "Can't find FULLTEXT index matching the column list"})
+
+	rows := sqlmock.NewRows([]string{
+		"book_id", "book_title", "author_id", "book_photo", "is_borrowed", "book_details", "author_lastname", "author_firstname",
+	}).AddRow(1, "The Hobbit", 1, "hobbit.jpg", false, "A hobbit's journey", "Tolkien", "J.R.R.")
+
+	mock.ExpectQuery(`books.title LIKE \? OR books.details LIKE \?`).
+		WithArgs("%hobbit%", "%hobbit%", "%hobbit%", 20, 0).
+		WillReturnRows(rows)
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM books`).
+		WithArgs("%hobbit%", "%hobbit%", "%hobbit%").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	service := NewSearchService(db)
+	result, err := service.SearchBooks(context.Background(), SearchQuery{Q: "hobbit"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(result.Items))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSearchService_SearchBooks_FiltersAndPagination(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{
+		"book_id", "book_title", "author_id", "book_photo", "is_borrowed", "book_details", "author_lastname", "author_firstname",
+	})
+
+	mock.ExpectQuery(`books.author_id = \? AND books.is_borrowed = \?`).
+		WithArgs(3, false, 10, 10).
+		WillReturnRows(rows)
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM books`).
+		WithArgs(3, false).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+	borrowed := false
+	service := NewSearchService(db)
+	result, err := service.SearchBooks(context.Background(), SearchQuery{
+		AuthorID: 3, Borrowed: &borrowed, Page: 2, PerPage: 10,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, result.Total)
+	assert.Equal(t, 2, result.Page)
+	assert.Equal(t, 10, result.PerPage)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSearchService_SearchAuthors(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"id", "lastname", "firstname", "photo"}).
+		AddRow(1, "Tolkien", "J.R.R.", "photo.jpg")
+
+	mock.ExpectQuery(`MATCH\(Lastname, Firstname\) AGAINST`).
+		WithArgs("tolkien", 20, 0).
+		WillReturnRows(rows)
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM authors`).
+		WithArgs("tolkien").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	service := NewSearchService(db)
+	result, err := service.SearchAuthors(context.Background(), SearchQuery{Q: "tolkien"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.Total)
+	assert.Equal(t, "Tolkien", result.Items[0].Lastname)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSearchBooksRanked_Handler(t *testing.T) {
+	app, mock := createTestApp(t)
+	defer app.DB.Close()
+
+	rows := sqlmock.NewRows([]string{
+		"book_id", "book_title", "author_id", "book_photo", "is_borrowed", "book_details", "author_lastname", "author_firstname",
+	}).AddRow(1, "The Hobbit", 1, "hobbit.jpg", false, "A hobbit's journey", "Tolkien", "J.R.R.")
+
+	mock.ExpectQuery(`MATCH\(books.title, books.details\) AGAINST`).
+		WithArgs("hobbit", "hobbit", 20, 0).
+		WillReturnRows(rows)
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM books`).
+		WithArgs("hobbit", "hobbit").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	req := httptest.NewRequest("GET", "/api/v1/search/books?q=hobbit", nil)
+	rr := httptest.NewRecorder()
+
+	app.SearchBooksRanked(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
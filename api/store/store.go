@@ -0,0 +1,497 @@
+// Package store is the data-access layer for the library API: it wraps
+// *sql.DB behind repository interfaces so handlers in package main are
+// responsible for HTTP concerns only, not SQL.
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Sentinel errors returned by LoanRepo.
+var (
+	// ErrBookNotFound means the book referenced by a loan operation does
+	// not exist.
+	ErrBookNotFound = errors.New("book not found")
+	// ErrAlreadyBorrowed means BorrowBook was called for a book that is
+	// already on loan.
+	ErrAlreadyBorrowed = errors.New("book is already borrowed")
+	// ErrLoanNotFound means ReturnBook was called with a loan ID that
+	// does not exist or has already been returned.
+	ErrLoanNotFound = errors.New("loan not found")
+)
+
+// ErrVersionConflict is returned by AuthorRepo.Update and BookRepo.Update
+// when the row's current version doesn't match the expectedVersion the
+// caller read it at, per the optimistic-locking scheme those methods
+// enforce.
+var ErrVersionConflict = errors.New("version conflict")
+
+// ErrNoPatchFields is returned by AuthorRepo.Patch and BookRepo.Patch
+// when none of the keys in fields name a patchable column.
+var ErrNoPatchFields = errors.New("no recognized fields to patch")
+
+// execer is satisfied by both *sql.DB and *sql.Tx, so the optimistic-
+// locking UPDATE an Update method runs can be reused, unchanged, by a
+// TxVariant that participates in a caller-managed transaction (e.g. a
+// bulk endpoint that must roll every item back together).
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// buildSetClause renders a deterministic "col = ?, col2 = ?" SQL fragment
+// from the entries of fields present in columns, in columns' order, along
+// with the args to bind to it. columns acts as both the column order and
+// a whitelist: keys in fields that aren't listed in columns are ignored,
+// so callers can pass a decoded JSON body straight through.
+func buildSetClause(fields map[string]interface{}, columns []string) (string, []interface{}) {
+	var parts []string
+	var args []interface{}
+	for _, col := range columns {
+		if v, ok := fields[col]; ok {
+			parts = append(parts, col+" = ?")
+			args = append(args, v)
+		}
+	}
+	return strings.Join(parts, ", "), args
+}
+
+// AuthorRepo persists and retrieves authors.
+type AuthorRepo interface {
+	List(ctx context.Context) (*sql.Rows, error)
+	// GetByIDs returns the authors matching ids, in no particular order,
+	// letting callers (e.g. a GraphQL dataloader) batch lookups instead
+	// of querying once per ID.
+	GetByIDs(ctx context.Context, ids []int) (*sql.Rows, error)
+	Create(ctx context.Context, lastname, firstname, photo string) (int64, error)
+	// GetByID returns the author's lastname, firstname, photo and current
+	// version, for read-modify-write callers that need the version to
+	// populate an ETag or retry an Update after ErrVersionConflict.
+	GetByID(ctx context.Context, id int) *sql.Row
+	// Update applies an optimistic-locking write: it only succeeds if the
+	// row's current version equals expectedVersion, and returns the row's
+	// new version on success. It returns ErrVersionConflict if no row
+	// matched both id and expectedVersion.
+	Update(ctx context.Context, id int, lastname, firstname, photo string, expectedVersion int) (int, error)
+	// UpdateTx is Update run against tx instead of the repo's own *sql.DB,
+	// for callers (e.g. BulkUpdateAuthors) that need several updates to
+	// share one transaction and roll back together.
+	UpdateTx(ctx context.Context, tx *sql.Tx, id int, lastname, firstname, photo string, expectedVersion int) (int, error)
+	// Patch applies the same optimistic-locking write as Update, but only
+	// to the columns present as keys of fields (one or more of
+	// "lastname", "firstname", "photo"); unrecognized keys are ignored,
+	// and an empty result returns ErrNoPatchFields.
+	Patch(ctx context.Context, id int, fields map[string]interface{}, expectedVersion int) (int, error)
+	// UpdatePhoto persists the full-size, medium, and thumbnail variants
+	// produced by the upload pipeline.
+	UpdatePhoto(ctx context.Context, id int, fullsize, medium, thumb string) error
+	Delete(ctx context.Context, id int) error
+}
+
+// authorPatchColumns lists the columns AuthorRepo.Patch may update, and
+// the order their SET clause is rendered in.
+var authorPatchColumns = []string{"lastname", "firstname", "photo"}
+
+type sqlAuthorRepo struct {
+	db *sql.DB
+}
+
+// NewAuthorRepo returns an AuthorRepo backed by db.
+func NewAuthorRepo(db *sql.DB) AuthorRepo {
+	return &sqlAuthorRepo{db: db}
+}
+
+func (r *sqlAuthorRepo) List(ctx context.Context) (*sql.Rows, error) {
+	return r.db.QueryContext(ctx, "SELECT id, Lastname, Firstname, photo FROM authors ORDER BY Lastname, Firstname")
+}
+
+func (r *sqlAuthorRepo) GetByIDs(ctx context.Context, ids []int) (*sql.Rows, error) {
+	if len(ids) == 0 {
+		return r.db.QueryContext(ctx, "SELECT id, Lastname, Firstname, photo FROM authors WHERE 1 = 0")
+	}
+
+	placeholders := strings.Repeat("?,", len(ids))
+	placeholders = placeholders[:len(placeholders)-1]
+
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+
+	query := fmt.Sprintf("SELECT id, Lastname, Firstname, photo FROM authors WHERE id IN (%s)", placeholders)
+	return r.db.QueryContext(ctx, query, args...)
+}
+
+func (r *sqlAuthorRepo) Create(ctx context.Context, lastname, firstname, photo string) (int64, error) {
+	result, err := r.db.ExecContext(
+		ctx,
+		"INSERT INTO authors (lastname, firstname, photo) VALUES (?, ?, ?)",
+		lastname, firstname, photo,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func (r *sqlAuthorRepo) GetByID(ctx context.Context, id int) *sql.Row {
+	return r.db.QueryRowContext(ctx, "SELECT Lastname, Firstname, photo, version FROM authors WHERE id = ?", id)
+}
+
+func (r *sqlAuthorRepo) Update(ctx context.Context, id int, lastname, firstname, photo string, expectedVersion int) (int, error) {
+	return authorUpdate(ctx, r.db, id, lastname, firstname, photo, expectedVersion)
+}
+
+func (r *sqlAuthorRepo) UpdateTx(ctx context.Context, tx *sql.Tx, id int, lastname, firstname, photo string, expectedVersion int) (int, error) {
+	return authorUpdate(ctx, tx, id, lastname, firstname, photo, expectedVersion)
+}
+
+func authorUpdate(ctx context.Context, x execer, id int, lastname, firstname, photo string, expectedVersion int) (int, error) {
+	result, err := x.ExecContext(
+		ctx,
+		"UPDATE authors SET lastname = ?, firstname = ?, photo = ?, version = version + 1 WHERE id = ? AND version = ?",
+		lastname, firstname, photo, id, expectedVersion,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if affected == 0 {
+		return 0, ErrVersionConflict
+	}
+
+	return expectedVersion + 1, nil
+}
+
+func (r *sqlAuthorRepo) Patch(ctx context.Context, id int, fields map[string]interface{}, expectedVersion int) (int, error) {
+	set, args := buildSetClause(fields, authorPatchColumns)
+	if set == "" {
+		return 0, ErrNoPatchFields
+	}
+
+	query := fmt.Sprintf("UPDATE authors SET %s, version = version + 1 WHERE id = ? AND version = ?", set)
+	args = append(args, id, expectedVersion)
+
+	result, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if affected == 0 {
+		return 0, ErrVersionConflict
+	}
+
+	return expectedVersion + 1, nil
+}
+
+func (r *sqlAuthorRepo) UpdatePhoto(ctx context.Context, id int, fullsize, medium, thumb string) error {
+	_, err := r.db.ExecContext(
+		ctx,
+		"UPDATE authors SET photo = ?, photo_medium = ?, photo_thumb = ? WHERE id = ?",
+		fullsize, medium, thumb, id,
+	)
+	return err
+}
+
+func (r *sqlAuthorRepo) Delete(ctx context.Context, id int) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM authors WHERE id = ?", id)
+	return err
+}
+
+// BookRepo persists and retrieves books.
+type BookRepo interface {
+	List(ctx context.Context) (*sql.Rows, error)
+	GetByID(ctx context.Context, id int) *sql.Row
+	Create(ctx context.Context, title, photo, details string, authorID int, isBorrowed bool) (int64, error)
+	// Update applies an optimistic-locking write: it only succeeds if the
+	// row's current version equals expectedVersion, and returns the row's
+	// new version on success. It returns ErrVersionConflict if no row
+	// matched both id and expectedVersion.
+	Update(ctx context.Context, id int, title, photo, details string, authorID int, isBorrowed bool, expectedVersion int) (int, error)
+	// UpdateTx is Update run against tx instead of the repo's own *sql.DB,
+	// for callers (e.g. BulkUpdateBooks) that need several updates to
+	// share one transaction and roll back together.
+	UpdateTx(ctx context.Context, tx *sql.Tx, id int, title, photo, details string, authorID int, isBorrowed bool, expectedVersion int) (int, error)
+	// Patch applies the same optimistic-locking write as Update, but only
+	// to the columns present as keys of fields (one or more of "title",
+	// "photo", "details", "author_id", "is_borrowed"); unrecognized keys
+	// are ignored, and an empty result returns ErrNoPatchFields.
+	Patch(ctx context.Context, id int, fields map[string]interface{}, expectedVersion int) (int, error)
+	// UpdatePhoto persists the full-size, medium, and thumbnail variants
+	// produced by the upload pipeline.
+	UpdatePhoto(ctx context.Context, id int, fullsize, medium, thumb string) error
+	Delete(ctx context.Context, id int) error
+}
+
+// bookPatchColumns lists the columns BookRepo.Patch may update, and the
+// order their SET clause is rendered in.
+var bookPatchColumns = []string{"title", "photo", "details", "author_id", "is_borrowed"}
+
+type sqlBookRepo struct {
+	db *sql.DB
+}
+
+// NewBookRepo returns a BookRepo backed by db.
+func NewBookRepo(db *sql.DB) BookRepo {
+	return &sqlBookRepo{db: db}
+}
+
+func (r *sqlBookRepo) List(ctx context.Context) (*sql.Rows, error) {
+	return r.db.QueryContext(
+		ctx,
+		"SELECT books.id AS book_id, books.title AS book_title, books.author_id AS author_id, books.photo AS book_photo, "+
+			"books.is_borrowed AS is_borrowed, books.details AS book_details, authors.Lastname AS author_lastname, authors.Firstname AS author_firstname "+
+			"FROM books JOIN authors ON books.author_id = authors.id",
+	)
+}
+
+func (r *sqlBookRepo) GetByID(ctx context.Context, id int) *sql.Row {
+	return r.db.QueryRowContext(
+		ctx,
+		"SELECT books.title AS book_title, books.author_id AS author_id, books.photo AS book_photo, books.is_borrowed AS is_borrowed, "+
+			"books.id AS book_id, books.details AS book_details, authors.Lastname AS author_lastname, authors.Firstname AS author_firstname, "+
+			"books.version AS book_version "+
+			"FROM books JOIN authors ON books.author_id = authors.id WHERE books.id = ?",
+		id,
+	)
+}
+
+func (r *sqlBookRepo) Create(ctx context.Context, title, photo, details string, authorID int, isBorrowed bool) (int64, error) {
+	result, err := r.db.ExecContext(
+		ctx,
+		"INSERT INTO books (title, photo, details, author_id, is_borrowed) VALUES (?, ?, ?, ?, ?)",
+		title, photo, details, authorID, isBorrowed,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func (r *sqlBookRepo) Update(ctx context.Context, id int, title, photo, details string, authorID int, isBorrowed bool, expectedVersion int) (int, error) {
+	return bookUpdate(ctx, r.db, id, title, photo, details, authorID, isBorrowed, expectedVersion)
+}
+
+func (r *sqlBookRepo) UpdateTx(ctx context.Context, tx *sql.Tx, id int, title, photo, details string, authorID int, isBorrowed bool, expectedVersion int) (int, error) {
+	return bookUpdate(ctx, tx, id, title, photo, details, authorID, isBorrowed, expectedVersion)
+}
+
+func bookUpdate(ctx context.Context, x execer, id int, title, photo, details string, authorID int, isBorrowed bool, expectedVersion int) (int, error) {
+	result, err := x.ExecContext(
+		ctx,
+		"UPDATE books SET title = ?, author_id = ?, photo = ?, details = ?, is_borrowed = ?, version = version + 1 WHERE id = ? AND version = ?",
+		title, authorID, photo, details, isBorrowed, id, expectedVersion,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if affected == 0 {
+		return 0, ErrVersionConflict
+	}
+
+	return expectedVersion + 1, nil
+}
+
+func (r *sqlBookRepo) Patch(ctx context.Context, id int, fields map[string]interface{}, expectedVersion int) (int, error) {
+	set, args := buildSetClause(fields, bookPatchColumns)
+	if set == "" {
+		return 0, ErrNoPatchFields
+	}
+
+	query := fmt.Sprintf("UPDATE books SET %s, version = version + 1 WHERE id = ? AND version = ?", set)
+	args = append(args, id, expectedVersion)
+
+	result, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if affected == 0 {
+		return 0, ErrVersionConflict
+	}
+
+	return expectedVersion + 1, nil
+}
+
+func (r *sqlBookRepo) UpdatePhoto(ctx context.Context, id int, fullsize, medium, thumb string) error {
+	_, err := r.db.ExecContext(
+		ctx,
+		"UPDATE books SET photo = ?, photo_medium = ?, photo_thumb = ? WHERE id = ?",
+		fullsize, medium, thumb, id,
+	)
+	return err
+}
+
+func (r *sqlBookRepo) Delete(ctx context.Context, id int) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM books WHERE id = ?", id)
+	return err
+}
+
+// SubscriberRepo persists and retrieves subscribers.
+type SubscriberRepo interface {
+	List(ctx context.Context) (*sql.Rows, error)
+	Create(ctx context.Context, lastname, firstname, email string) (int64, error)
+	// CreateWithPassword registers a subscriber with login credentials,
+	// for self-service sign-up through /register.
+	CreateWithPassword(ctx context.Context, lastname, firstname, email, passwordHash, role string) (int64, error)
+	// GetByEmail looks up the credentials and role for email, for /login.
+	GetByEmail(ctx context.Context, email string) *sql.Row
+}
+
+type sqlSubscriberRepo struct {
+	db *sql.DB
+}
+
+// NewSubscriberRepo returns a SubscriberRepo backed by db.
+func NewSubscriberRepo(db *sql.DB) SubscriberRepo {
+	return &sqlSubscriberRepo{db: db}
+}
+
+func (r *sqlSubscriberRepo) List(ctx context.Context) (*sql.Rows, error) {
+	return r.db.QueryContext(ctx, "SELECT lastname, firstname, email FROM subscribers")
+}
+
+func (r *sqlSubscriberRepo) Create(ctx context.Context, lastname, firstname, email string) (int64, error) {
+	result, err := r.db.ExecContext(
+		ctx,
+		"INSERT INTO subscribers (lastname, firstname, email) VALUES (?, ?, ?)",
+		lastname, firstname, email,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func (r *sqlSubscriberRepo) CreateWithPassword(ctx context.Context, lastname, firstname, email, passwordHash, role string) (int64, error) {
+	result, err := r.db.ExecContext(
+		ctx,
+		"INSERT INTO subscribers (lastname, firstname, email, password_hash, role) VALUES (?, ?, ?, ?, ?)",
+		lastname, firstname, email, passwordHash, role,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func (r *sqlSubscriberRepo) GetByEmail(ctx context.Context, email string) *sql.Row {
+	return r.db.QueryRowContext(ctx, "SELECT id, password_hash, role FROM subscribers WHERE email = ?", email)
+}
+
+// LoanRepo runs the borrow/return workflow as single transactions, so the
+// books.is_borrowed flag and the loans table never drift apart under
+// concurrent requests.
+type LoanRepo interface {
+	// BorrowBook locks the book row, verifies it is not already on loan,
+	// inserts a loan record and flips is_borrowed, all within one
+	// transaction. It returns ErrBookNotFound or ErrAlreadyBorrowed when
+	// the borrow cannot proceed.
+	BorrowBook(ctx context.Context, bookID, subscriberID int) (int64, error)
+	// ReturnBook closes out an open loan and flips the book's
+	// is_borrowed flag back off, within one transaction. It returns the
+	// loan's book ID (so callers can publish a book-event without a
+	// second lookup) and ErrLoanNotFound if loanID does not reference an
+	// open loan.
+	ReturnBook(ctx context.Context, loanID int) (int, error)
+}
+
+type sqlLoanRepo struct {
+	db *sql.DB
+}
+
+// NewLoanRepo returns a LoanRepo backed by db.
+func NewLoanRepo(db *sql.DB) LoanRepo {
+	return &sqlLoanRepo{db: db}
+}
+
+func (r *sqlLoanRepo) BorrowBook(ctx context.Context, bookID, subscriberID int) (int64, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	var isBorrowed bool
+	err = tx.QueryRowContext(ctx, "SELECT is_borrowed FROM books WHERE id = ? FOR UPDATE", bookID).Scan(&isBorrowed)
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrBookNotFound
+		}
+		return 0, err
+	}
+	if isBorrowed {
+		tx.Rollback()
+		return 0, ErrAlreadyBorrowed
+	}
+
+	result, err := tx.ExecContext(ctx, "INSERT INTO loans (subscriber_id, book_id, borrowed_at) VALUES (?, ?, NOW())", subscriberID, bookID)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE books SET is_borrowed = TRUE WHERE id = ?", bookID); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
+
+func (r *sqlLoanRepo) ReturnBook(ctx context.Context, loanID int) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	var bookID int
+	err = tx.QueryRowContext(ctx, "SELECT book_id FROM loans WHERE id = ? AND returned_at IS NULL FOR UPDATE", loanID).Scan(&bookID)
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrLoanNotFound
+		}
+		return 0, err
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE loans SET returned_at = NOW() WHERE id = ?", loanID); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE books SET is_borrowed = FALSE WHERE id = ?", bookID); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return bookID, nil
+}
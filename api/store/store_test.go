@@ -0,0 +1,224 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoanRepo_BorrowBook_Success(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT is_borrowed FROM books WHERE id = \\? FOR UPDATE").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"is_borrowed"}).AddRow(false))
+	mock.ExpectExec("INSERT INTO loans").
+		WithArgs(2, 1).
+		WillReturnResult(sqlmock.NewResult(42, 1))
+	mock.ExpectExec("UPDATE books SET is_borrowed = TRUE WHERE id = \\?").
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	repo := NewLoanRepo(db)
+	loanID, err := repo.BorrowBook(context.Background(), 1, 2)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), loanID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLoanRepo_BorrowBook_AlreadyBorrowedRollsBack(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT is_borrowed FROM books WHERE id = \\? FOR UPDATE").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"is_borrowed"}).AddRow(true))
+	mock.ExpectRollback()
+
+	repo := NewLoanRepo(db)
+	_, err = repo.BorrowBook(context.Background(), 1, 2)
+
+	assert.ErrorIs(t, err, ErrAlreadyBorrowed)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLoanRepo_BorrowBook_NotFoundRollsBack(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT is_borrowed FROM books WHERE id = \\? FOR UPDATE").
+		WithArgs(1).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	repo := NewLoanRepo(db)
+	_, err = repo.BorrowBook(context.Background(), 1, 2)
+
+	assert.ErrorIs(t, err, ErrBookNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLoanRepo_ReturnBook_Success(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT book_id FROM loans WHERE id = \\? AND returned_at IS NULL FOR UPDATE").
+		WithArgs(42).
+		WillReturnRows(sqlmock.NewRows([]string{"book_id"}).AddRow(1))
+	mock.ExpectExec("UPDATE loans SET returned_at = NOW\\(\\) WHERE id = \\?").
+		WithArgs(42).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE books SET is_borrowed = FALSE WHERE id = \\?").
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	repo := NewLoanRepo(db)
+	bookID, err := repo.ReturnBook(context.Background(), 42)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, bookID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLoanRepo_ReturnBook_NotFoundRollsBack(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT book_id FROM loans WHERE id = \\? AND returned_at IS NULL FOR UPDATE").
+		WithArgs(42).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	repo := NewLoanRepo(db)
+	_, err = repo.ReturnBook(context.Background(), 42)
+
+	assert.ErrorIs(t, err, ErrLoanNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAuthorRepo_Update_VersionConflict(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec("UPDATE authors SET lastname = \\?, firstname = \\?, photo = \\?, version = version \\+ 1 WHERE id = \\? AND version = \\?").
+		WithArgs("Doe", "Jane", "jane.jpg", 1, 1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	repo := NewAuthorRepo(db)
+	_, err = repo.Update(context.Background(), 1, "Doe", "Jane", "jane.jpg", 1)
+
+	assert.ErrorIs(t, err, ErrVersionConflict)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAuthorRepo_Patch_OnlyUpdatesGivenFields(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec("UPDATE authors SET photo = \\?, version = version \\+ 1 WHERE id = \\? AND version = \\?").
+		WithArgs("new.jpg", 1, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	repo := NewAuthorRepo(db)
+	version, err := repo.Patch(context.Background(), 1, map[string]interface{}{"photo": "new.jpg"}, 1)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, version)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAuthorRepo_Patch_NoRecognizedFields(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewAuthorRepo(db)
+	_, err = repo.Patch(context.Background(), 1, map[string]interface{}{"unknown": "value"}, 1)
+
+	assert.ErrorIs(t, err, ErrNoPatchFields)
+}
+
+func TestBookRepo_Patch_OnlyUpdatesGivenFields(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec("UPDATE books SET is_borrowed = \\?, version = version \\+ 1 WHERE id = \\? AND version = \\?").
+		WithArgs(true, 1, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	repo := NewBookRepo(db)
+	version, err := repo.Patch(context.Background(), 1, map[string]interface{}{"is_borrowed": true}, 1)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, version)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBookRepo_Patch_NoRecognizedFields(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewBookRepo(db)
+	_, err = repo.Patch(context.Background(), 1, map[string]interface{}{"unknown": "value"}, 1)
+
+	assert.ErrorIs(t, err, ErrNoPatchFields)
+}
+
+func TestBookRepo_Update_VersionConflict(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec("UPDATE books SET title = \\?, author_id = \\?, photo = \\?, details = \\?, is_borrowed = \\?, version = version \\+ 1 WHERE id = \\? AND version = \\?").
+		WithArgs("New Title", 1, "new.jpg", "details", false, 1, 1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	repo := NewBookRepo(db)
+	_, err = repo.Update(context.Background(), 1, "New Title", "new.jpg", "details", 1, false, 1)
+
+	assert.ErrorIs(t, err, ErrVersionConflict)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}